@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/measurement-kit/mkbuild/cmake"
+	"github.com/measurement-kit/mkbuild/diff"
+	"github.com/measurement-kit/mkbuild/docker"
+	"github.com/measurement-kit/mkbuild/pkginfo"
+)
+
+// generatedFile is a file generated by mkbuild.
+type generatedFile struct {
+	// filename is the name of the generated file
+	filename string
+
+	// kind is the value of -only selecting this file
+	kind string
+
+	// render renders the file content
+	render func(*pkginfo.PkgInfo, io.Writer) error
+}
+
+// generatedFiles returns all the files generated by mkbuild.
+func (ctx *context) generatedFiles() []generatedFile {
+	return []generatedFile{
+		{ctx.outputFilename("CMakeLists.txt"), "cmake", cmake.Render},
+		{ctx.lockFilename(), "cmake", cmake.RenderLock},
+		{ctx.outputFilename("docker.sh"), "docker", docker.Render},
+	}
+}
+
+// runCheck implements `mkbuild check`.
+func runCheck(ctx *context, args []string) error {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	only := flags.String("only", "", "Only check `cmake` or `docker` files")
+	noDiff := flags.Bool("no-diff", false, "Only check MKBuild.yaml, not the generated files")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		return fmt.Errorf("check: unexpected arguments: %v", flags.Args())
+	}
+	if *only != "" && *only != "cmake" && *only != "docker" {
+		return fmt.Errorf("check: --only must be cmake or docker, not %s", *only)
+	}
+	pkginfo, err := ctx.loadPkgInfo()
+	if err != nil {
+		return err
+	}
+	var stale []string
+	for _, file := range ctx.generatedFiles() {
+		if *only != "" && *only != file.kind {
+			continue
+		}
+		var rendered bytes.Buffer
+		if err := file.render(pkginfo, &rendered); err != nil {
+			return fmt.Errorf("cannot render %s: %s", file.filename, err.Error())
+		}
+		if *noDiff {
+			continue
+		}
+		current, err := ioutil.ReadFile(file.filename)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		patch := diff.Unified(
+			file.filename, file.filename+" (generated)",
+			string(current), rendered.String(),
+		)
+		if patch != "" {
+			fmt.Print(patch)
+			stale = append(stale, file.filename)
+		}
+	}
+	if len(stale) > 0 {
+		log.Warnf("out of date: %v", stale)
+		return errors.New("check: generated files do not match " +
+			ctx.filename + "; please run `mkbuild generate`")
+	}
+	if *noDiff {
+		log.Infof("%s is valid", ctx.filename)
+		return nil
+	}
+	log.Infof("%s and the generated files are consistent", ctx.filename)
+	return nil
+}
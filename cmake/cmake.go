@@ -2,7 +2,12 @@
 package cmake
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/apex/log"
 	"github.com/measurement-kit/mkbuild/cmake/cmakefile"
@@ -37,6 +42,15 @@ func sortedScriptBuildInfo(m map[string]pkginfo.ScriptBuildInfo) []string {
 	return res
 }
 
+func sortedAmalgamate(m map[string][]string) []string {
+	var res []string
+	for k, _ := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
 func sortedTestInfo(m map[string]pkginfo.TestInfo) []string {
 	var res []string
 	for k, _ := range m {
@@ -46,12 +60,119 @@ func sortedTestInfo(m map[string]pkginfo.TestInfo) []string {
 	return res
 }
 
-// Generate generates a CMakeLists.txt file.
-func Generate(pkginfo *pkginfo.PkgInfo) {
-	cmake := cmakefile.Open(pkginfo.Name)
-	defer cmake.Close()
-	for key, values := range pkginfo.Amalgamate {
-		cmake.Amalgamate(key, values)
+// libraryLinks returns the libraries that a library linking with |link|
+// links with. We do not install object libraries and libraries without
+// install, hence we only link with them at build time, so that installed
+// libraries can be exported.
+func libraryLinks(pkginfo *pkginfo.PkgInfo, link []string) []string {
+	var res []string
+	for _, name := range link {
+		if lib, found := pkginfo.Targets.Libraries[name]; found &&
+			(lib.Type == "object" || !lib.Install) {
+			name = "$<BUILD_INTERFACE:" + name + ">"
+		}
+		res = append(res, name)
+	}
+	return res
+}
+
+// pkgConfigBuilder builds the pkg-config file description of a library
+type pkgConfigBuilder struct {
+	pkginfo *pkginfo.PkgInfo
+	pc      *cmakefile.PkgConfig
+	all     bool
+	used    map[string]bool
+	visited map[string]bool
+}
+
+// visit adds what the library described by |buildinfo| needs. A library
+// needs the installed libraries that it links with, which have their own
+// pkg-config file, and what the other libraries that it links with need,
+// since we do not install them.
+func (b *pkgConfigBuilder) visit(buildinfo pkginfo.LibraryBuildInfo) error {
+	dependencies, err := b.pkginfo.TargetDependencies(buildinfo.Dependencies)
+	if err != nil {
+		return err
+	}
+	b.all = b.all || dependencies == nil
+	for _, id := range dependencies {
+		b.used[id] = true
+	}
+	for _, name := range buildinfo.Link {
+		lib, found := b.pkginfo.Targets.Libraries[name]
+		if !found || b.visited[name] {
+			continue
+		}
+		b.visited[name] = true
+		if lib.Install && lib.Type != "object" {
+			b.pc.Requires = append(b.pc.Requires, name)
+			continue
+		}
+		if len(lib.Compile) > 0 && lib.Type != "object" {
+			b.pc.Libs = append(b.pc.Libs, "-l"+name)
+		}
+		if err := b.visit(lib); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newPkgConfig returns the pkg-config file description of the library
+// described by |buildinfo|, which needs some of the |resolved| and of the
+// |optional| dependencies.
+func newPkgConfig(
+	pkginfo *pkginfo.PkgInfo, buildinfo pkginfo.LibraryBuildInfo,
+	resolved, optional []*deps.Resolved,
+) (*cmakefile.PkgConfig, error) {
+	b := &pkgConfigBuilder{
+		pkginfo: pkginfo,
+		pc: &cmakefile.PkgConfig{
+			Description: pkginfo.Description,
+			URL:         pkginfo.HomepageURL,
+			Version:     pkginfo.Version,
+		},
+		used:    make(map[string]bool),
+		visited: make(map[string]bool),
+	}
+	if err := b.visit(buildinfo); err != nil {
+		return nil, err
+	}
+	for _, dep := range resolved {
+		if b.all || b.used[dep.ID] {
+			if dependency := dep.PkgConfig(); dependency != nil {
+				b.pc.Dependencies = append(b.pc.Dependencies, *dependency)
+			}
+		}
+	}
+	for _, dep := range optional {
+		if b.all || b.used[dep.ID] {
+			if dependency := dep.PkgConfig(); dependency != nil {
+				dependency.Feature = dep.Feature()
+				b.pc.Dependencies = append(b.pc.Dependencies, *dependency)
+			}
+		}
+	}
+	return b.pc, nil
+}
+
+// Render renders the CMakeLists.txt for |pkginfo| into |w|.
+func Render(pkginfo *pkginfo.PkgInfo, w io.Writer) error {
+	cmake := cmakefile.Open(&cmakefile.Project{
+		Name:        pkginfo.Name,
+		Version:     pkginfo.Version,
+		Description: pkginfo.Description,
+		HomepageURL: pkginfo.HomepageURL,
+		License:     pkginfo.License,
+	})
+	if pkginfo.CMakeStyle == "targets" {
+		cmake.UseTargetUsageRequirements()
+	}
+	for _, mirror := range pkginfo.Mirrors {
+		cmake.AddMirror(mirror)
+	}
+	for _, key := range sortedAmalgamate(pkginfo.Amalgamate) {
+		cmake.Amalgamate(key, pkginfo.Amalgamate[key])
 	}
 	for _, funcheck := range pkginfo.FunctionChecks {
 		cmake.CheckFunctionExists(funcheck.Name, funcheck.Define)
@@ -59,27 +180,87 @@ func Generate(pkginfo *pkginfo.PkgInfo) {
 	for _, symcheck := range pkginfo.SymbolChecks {
 		cmake.CheckSymbolExists(symcheck.Name, symcheck.Header, symcheck.Define)
 	}
-	for _, depname := range pkginfo.Dependencies {
-		handler, ok := deps.All[depname]
-		if !ok {
-			log.Fatalf("unknown dependency: %s", depname)
+	resolved, err := pkginfo.Resolve()
+	if err != nil {
+		return err
+	}
+	optional, err := pkginfo.ResolveOptional()
+	if err != nil {
+		return err
+	}
+	var artifacts, win32Artifacts []cmakefile.Artifact
+	for _, dep := range resolved {
+		if artifact, win32 := dep.Artifact(); artifact != nil && win32 {
+			win32Artifacts = append(win32Artifacts, *artifact)
+		} else if artifact != nil {
+			artifacts = append(artifacts, *artifact)
 		}
-		handler(cmake)
+	}
+	if len(artifacts) > 0 {
+		cmake.CheckOffline(artifacts)
+	}
+	if len(win32Artifacts) > 0 {
+		cmake.IfWIN32(func() {
+			cmake.CheckOffline(win32Artifacts)
+		}, nil)
+	}
+	for _, dep := range append(resolved, optional...) {
+		if len(dep.Constraints) > 0 {
+			cmake.DefineCheckVersion()
+			break
+		}
+	}
+	for _, dep := range resolved {
+		cmake.AddDependency(dep.ID, func() {
+			dep.Apply(cmake)
+		})
+	}
+	for _, dep := range optional {
+		cmake.AddDependency(dep.ID, func() {
+			dep.ApplyOptional(cmake)
+		})
 	}
 	cmake.FinalizeCompilerFlags()
+	cmake.AddVersionHeader()
 	for _, name := range sortedLibraryBuildInfo(pkginfo.Targets.Libraries) {
 		buildinfo := pkginfo.Targets.Libraries[name]
-		cmake.AddLibrary(
-			name, buildinfo.Compile, buildinfo.Link, buildinfo.Install,
-			buildinfo.Headers,
-		)
+		dependencies, err := pkginfo.TargetDependencies(buildinfo.Dependencies)
+		if err != nil {
+			return err
+		}
+		soversion := buildinfo.SOVersion
+		if soversion == "" && pkginfo.Version != "" {
+			soversion = strings.Split(pkginfo.Version, ".")[0]
+		}
+		pc, err := newPkgConfig(pkginfo, buildinfo, resolved, optional)
+		if err != nil {
+			return err
+		}
+		cmake.AddLibrary(&cmakefile.Library{
+			Name:         name,
+			Type:         buildinfo.Type,
+			Sources:      buildinfo.Compile,
+			Libs:         libraryLinks(pkginfo, buildinfo.Link),
+			Dependencies: dependencies,
+			Install:      buildinfo.Install,
+			Headers:      buildinfo.Headers,
+			Version:      pkginfo.Version,
+			SOVersion:    soversion,
+			PkgConfig:    pc,
+		})
 	}
 	for _, name := range sortedBuildInfo(pkginfo.Targets.Executables) {
 		buildinfo := pkginfo.Targets.Executables[name]
+		dependencies, err := pkginfo.TargetDependencies(buildinfo.Dependencies)
+		if err != nil {
+			return err
+		}
 		cmake.AddExecutable(
-			name, buildinfo.Compile, buildinfo.Link, buildinfo.Install,
+			name, buildinfo.Compile, buildinfo.Link, dependencies,
+			buildinfo.Install,
 		)
 	}
+	cmake.AddPackageConfig()
 	for _, name := range sortedScriptBuildInfo(pkginfo.Targets.Scripts) {
 		buildinfo := pkginfo.Targets.Scripts[name]
 		cmake.AddScript(name, buildinfo.Install)
@@ -88,4 +269,44 @@ func Generate(pkginfo *pkginfo.PkgInfo) {
 		testinfo := pkginfo.Tests[name]
 		cmake.AddTest(name, testinfo.Command)
 	}
+	cmake.AddCPack()
+	_, err = cmake.WriteTo(w)
+	return err
+}
+
+// RenderLock renders the MKBuild.lock for |pkginfo| into |w|.
+func RenderLock(pkginfo *pkginfo.PkgInfo, w io.Writer) error {
+	resolved, err := pkginfo.Resolve()
+	if err != nil {
+		return err
+	}
+	_, err = deps.NewLock(resolved).WriteTo(w)
+	return err
+}
+
+// writeFile writes |filename| using |render|. We render in memory first,
+// so that a failure leaves the existing |filename| intact.
+func writeFile(
+	pkginfo *pkginfo.PkgInfo, filename string,
+	render func(*pkginfo.PkgInfo, io.Writer) error,
+) error {
+	var buffer bytes.Buffer
+	if err := render(pkginfo, &buffer); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filename, buffer.Bytes(), 0644); err != nil {
+		return err
+	}
+	log.Infof("Written %s", filename)
+	return nil
+}
+
+// Generate writes the CMakeLists.txt for |pkginfo| in |dir|.
+func Generate(pkginfo *pkginfo.PkgInfo, dir string) error {
+	return writeFile(pkginfo, filepath.Join(dir, "CMakeLists.txt"), Render)
+}
+
+// GenerateLock writes the MKBuild.lock for |pkginfo| to |filename|.
+func GenerateLock(pkginfo *pkginfo.PkgInfo, filename string) error {
+	return writeFile(pkginfo, filename, RenderLock)
 }
@@ -0,0 +1,61 @@
+package cmake
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/measurement-kit/mkbuild/cmake/deps"
+	"github.com/measurement-kit/mkbuild/diff"
+	"github.com/measurement-kit/mkbuild/pkginfo"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// TestRender renders the testdata/<name>/MKBuild.yaml files and compares
+// the result with the testdata/<name>/CMakeLists.txt golden files. Run
+// `go test ./cmake -update` to update them after an intended change.
+func TestRender(t *testing.T) {
+	if value, found := os.LookupEnv(deps.EnvVar); found {
+		os.Unsetenv(deps.EnvVar)
+		defer os.Setenv(deps.EnvVar, value)
+	}
+	configs, err := filepath.Glob(filepath.Join("testdata", "*", "MKBuild.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) <= 0 {
+		t.Fatal("no MKBuild.yaml in testdata")
+	}
+	for _, config := range configs {
+		dir := filepath.Dir(config)
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			info, err := pkginfo.Load(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buffer bytes.Buffer
+			if err := Render(info, &buffer); err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join(dir, "CMakeLists.txt")
+			if *update {
+				if err := ioutil.WriteFile(golden, buffer.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := buffer.String(); got != string(want) {
+				t.Fatalf("%s is out of date:\n%s", golden,
+					diff.Unified(golden, "rendered", string(want), got))
+			}
+		})
+	}
+}
@@ -3,13 +3,15 @@ package cmakefile
 
 import (
 	"fmt"
-	"os"
+	"io"
+	"path"
 	"path/filepath"
 	"strings"
 
-	"github.com/apex/log"
+	"github.com/measurement-kit/mkbuild/cmake/cmakefile/download"
 	"github.com/measurement-kit/mkbuild/cmake/cmakefile/prebuilt"
 	"github.com/measurement-kit/mkbuild/cmake/cmakefile/restrictiveflags"
+	"github.com/measurement-kit/mkbuild/cmake/cmakefile/versioncheck"
 )
 
 // CMakeFile is a CMakeListst.txt file
@@ -19,6 +21,34 @@ type CMakeFile struct {
 
 	// indent is the indent string to prefix to each line
 	indent string
+
+	// optional is the variable to clear when a check fails, or empty
+	// if a failing check is a fatal error
+	optional string
+
+	// targetBased indicates whether to use per target usage requirements
+	// rather than global include directories and definitions
+	targetBased bool
+
+	// project is the name of the project
+	project string
+
+	// metadata contains the project metadata
+	metadata Project
+
+	// exported indicates whether we exported some installed targets
+	exported bool
+
+	// installed indicates whether we installed something
+	installed bool
+}
+
+// UseTargetUsageRequirements configures |cmake| to pass include directories,
+// definitions and libraries to each target, using the PUBLIC scope for
+// libraries, so that their usage requirements flow to their users, and
+// the PRIVATE scope for executables. Call it before adding dependencies.
+func (cmake *CMakeFile) UseTargetUsageRequirements() {
+	cmake.targetBased = true
 }
 
 // WithIndent runs |func| with the specified |indent|.
@@ -46,28 +76,53 @@ func (cmake *CMakeFile) writeEmptyLine() {
 // WriteLine writes a line to the CMakeLists.txt file.
 func (cmake *CMakeFile) WriteLine(s string) {
 	if s != "" {
-		_, err := cmake.output.WriteString(cmake.indent)
-		if err != nil {
-			log.WithError(err).Fatal("cannot write indent")
-		}
-		_, err = cmake.output.WriteString(s)
-		if err != nil {
-			log.WithError(err).Fatal("cannot write string")
-		}
-	}
-	_, err := cmake.output.WriteString("\n")
-	if err != nil {
-		log.WithError(err).Fatal("cannot write newline")
+		cmake.output.WriteString(cmake.indent)
+		cmake.output.WriteString(s)
 	}
+	cmake.output.WriteString("\n")
+}
+
+// Project contains the project metadata
+type Project struct {
+	// Name is the name of the project
+	Name string
+
+	// Version is the version of the project (e.g. "0.12.0"), if known
+	Version string
+
+	// Description is a short description of the project, if known
+	Description string
+
+	// HomepageURL is the URL of the project homepage, if known
+	HomepageURL string
+
+	// License is the SPDX identifier of the license (e.g. "BSD-2-Clause"),
+	// if known
+	License string
 }
 
-// Open opens a CMake project named |name|.
-func Open(name string) *CMakeFile {
-	cmake := &CMakeFile{}
+// Open opens the CMake project described by |project|.
+func Open(project *Project) *CMakeFile {
+	cmake := &CMakeFile{project: project.Name, metadata: *project}
 	cmake.WriteLine("# Autogenerated by `mkbuild`; DO NOT EDIT!")
 	cmake.writeEmptyLine()
 	cmake.WriteLine(fmt.Sprintf("cmake_minimum_required(VERSION 3.12.0)"))
-	cmake.WriteLine(fmt.Sprintf("project(\"%s\")", name))
+	if project.Version == "" && project.Description == "" && project.HomepageURL == "" {
+		cmake.WriteLine(fmt.Sprintf("project(\"%s\")", project.Name))
+	} else {
+		cmake.WriteLine(fmt.Sprintf("project("))
+		cmake.WriteLine(fmt.Sprintf("  \"%s\"", project.Name))
+		if project.Version != "" {
+			cmake.WriteLine(fmt.Sprintf("  VERSION %s", project.Version))
+		}
+		if project.Description != "" {
+			cmake.WriteLine(fmt.Sprintf("  DESCRIPTION \"%s\"", cmakeQuote(project.Description)))
+		}
+		if project.HomepageURL != "" {
+			cmake.WriteLine(fmt.Sprintf("  HOMEPAGE_URL \"%s\"", cmakeQuote(project.HomepageURL)))
+		}
+		cmake.WriteLine(fmt.Sprintf(")"))
+	}
 	cmake.writeEmptyLine()
 	cmake.WriteLine("include(CheckIncludeFileCXX)")
 	cmake.WriteLine("include(CheckLibraryExists)")
@@ -88,6 +143,8 @@ func Open(name string) *CMakeFile {
 	cmake.IfWIN32(func() {
 		cmake.WriteLine("list(APPEND CMAKE_REQUIRED_LIBRARIES ws2_32 crypt32)")
 	}, nil)
+	cmake.WriteLine("set(MK_BASE_LIBRARIES ${CMAKE_REQUIRED_LIBRARIES})")
+	cmake.WriteLine("set(MK_PACKAGE_DEPENDENCIES Threads)")
 	cmake.writeEmptyLine()
 	cmake.WriteLine("enable_testing()")
 	cmake.IfWIN32(func() {
@@ -107,16 +164,74 @@ func Open(name string) *CMakeFile {
 	cmake.writeEmptyLine()
 	cmake.WriteLine(`include(CheckFunctionExists)`)
 	cmake.WriteLine(`include(CheckSymbolExists)`)
+	cmake.writeDownloadFunction()
 	return cmake
 }
 
-// download downloads |URL| to |filename| and checks the |SHA256|.
-func (cmake *CMakeFile) download(filename, SHA256, URL string) {
-	cmake.WriteLine(fmt.Sprintf("message(STATUS \"download: %s\")", URL))
-	cmake.WriteLine(fmt.Sprintf("file(DOWNLOAD %s", URL))
+// VendoredPath returns the path, relative to the vendor directory, of
+// the vendored copy of |URL|. This is the URL without the scheme (and
+// with colons replaced by underscores), so that vendored files are
+// unique and easy to recognize.
+func VendoredPath(URL string) string {
+	if idx := strings.Index(URL, "://"); idx >= 0 {
+		URL = URL[idx+3:]
+	}
+	return path.Clean(strings.Replace(URL, ":", "_", -1))
+}
+
+// writeDownloadFunction writes the CMake function used to download
+// dependencies.
+func (cmake *CMakeFile) writeDownloadFunction() {
+	cmake.writeSectionComment("Download dependencies")
+	cmake.output.WriteString(download.S)
+}
+
+// download downloads |URL| to |filename| and checks the |SHA256|. We
+// use the vendored copy of |URL|, if available, and otherwise we try
+// the mirrors, |URL|, and the |fallbacks| URLs, in this order.
+func (cmake *CMakeFile) download(filename, SHA256, URL string, fallbacks []string) {
+	cmake.WriteLine("MKBuildDownload(")
 	cmake.WriteLine(fmt.Sprintf("  \"%s\"", filename))
-	cmake.WriteLine(fmt.Sprintf("  EXPECTED_HASH SHA256=%s", SHA256))
-	cmake.WriteLine(fmt.Sprintf("  TLS_VERIFY ON)"))
+	cmake.WriteLine(fmt.Sprintf("  %s", SHA256))
+	cmake.WriteLine(fmt.Sprintf("  \"%s\"", VendoredPath(URL)))
+	cmake.WriteLine(fmt.Sprintf("  \"%s\"", URL))
+	for _, fallback := range fallbacks {
+		cmake.WriteLine(fmt.Sprintf("  \"%s\"", fallback))
+	}
+	cmake.WriteLine(")")
+}
+
+// Artifact is a file downloaded at configure time
+type Artifact struct {
+	// SHA256 is the SHA256 of the file
+	SHA256 string
+
+	// URL is the upstream URL of the file
+	URL string
+}
+
+// CheckOffline writes code that, when the MKBUILD_OFFLINE option is ON,
+// fails unless all the |artifacts| are vendored or cached. This allows
+// us to report all the missing artifacts at once.
+func (cmake *CMakeFile) CheckOffline(artifacts []Artifact) {
+	cmake.writeSectionComment("Check for missing dependencies when offline")
+	cmake.WriteLine("MKBuildCheckOffline(")
+	for _, artifact := range artifacts {
+		cmake.WriteLine(fmt.Sprintf(
+			"  \"%s\" %s", VendoredPath(artifact.URL), artifact.SHA256,
+		))
+	}
+	cmake.WriteLine(")")
+}
+
+// AddMirror adds |prefix| to the mirrors that we try before the upstream
+// URLs. The URL of a dependency on a mirror is |prefix| followed by a
+// slash and by the VendoredPath of the upstream URL. Mirrors in the
+// MKBUILD_MIRROR CMake (or environment) variable come first.
+func (cmake *CMakeFile) AddMirror(prefix string) {
+	cmake.WriteLine(fmt.Sprintf(
+		"list(APPEND MKBUILD_PROJECT_MIRRORS \"%s\")", prefix,
+	))
 }
 
 // checkCommandError writes the code to check for errors after a
@@ -221,6 +336,11 @@ func (cmake *CMakeFile) AddRequiredLibrary(library string) {
 // checkPlatformCheckResult writes code to deal with a platform check result.
 func (cmake *CMakeFile) checkPlatformCheckResult(item, variable string) {
 	cmake.WriteLine(fmt.Sprintf("if(NOT (\"${%s}\"))", variable))
+	if cmake.optional != "" {
+		cmake.WriteLine(fmt.Sprintf("  set(%s OFF)", cmake.optional))
+		cmake.WriteLine(fmt.Sprintf("endif()"))
+		return
+	}
 	cmake.WriteLine(fmt.Sprintf(
 		"  message(FATAL_ERROR \"cannot find: %s\")", item,
 	))
@@ -245,6 +365,169 @@ func (cmake *CMakeFile) RequireLibraryExists(library, function string) {
 	cmake.checkPlatformCheckResult(library, variable)
 }
 
+// DefineCheckVersion defines the function used by CheckVersion. Call it
+// once, outside of any conditional block, before calling CheckVersion.
+func (cmake *CMakeFile) DefineCheckVersion() {
+	cmake.writeSectionComment("Check the version of system libraries")
+	cmake.output.WriteString(versioncheck.S)
+}
+
+// CheckVersion writes code failing unless the version of the |name|
+// system library satisfies all the |constraints|. We find out the version
+// by printing |macro|, defined by |header|, if not empty, or otherwise by
+// querying the version of the first pkg-config module in |modules|.
+func (cmake *CMakeFile) CheckVersion(
+	name string, constraints []string, header, macro string, modules []string,
+) {
+	check := func() {
+		cmake.WriteLine(fmt.Sprintf("MKBuildCheckVersion(\"%s\"", name))
+		cmake.WriteLine(fmt.Sprintf("  CONSTRAINTS \"%s\"", strings.Join(constraints, "\" \"")))
+		if header != "" {
+			cmake.WriteLine(fmt.Sprintf("  HEADER \"%s\" MACRO %s", header, macro))
+		}
+		if len(modules) > 0 {
+			cmake.WriteLine(fmt.Sprintf("  PKG_CONFIG %s", strings.Join(modules, " ")))
+		}
+		if cmake.optional != "" {
+			cmake.WriteLine(fmt.Sprintf("  RESULT %s", cmake.optional))
+		}
+		cmake.WriteLine(")")
+	}
+	if cmake.optional == "" {
+		check()
+		return
+	}
+	// No need to check the version of a missing optional dependency
+	cmake.WriteLine(fmt.Sprintf("if((\"${%s}\"))", cmake.optional))
+	cmake.WithIndent("  ", check)
+	cmake.WriteLine("endif()")
+}
+
+// identifier converts |s| to an uppercase CMake and C identifier.
+func identifier(s string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(s))
+}
+
+// AddOptional runs |fn|, which adds the |name| dependency, such that
+// failing checks do not stop the build. When all the checks succeed, we
+// define MK_HAVE_<FEATURE> both as a variable and as a preprocessor macro.
+// Otherwise, we print a message and forget the dependency.
+func (cmake *CMakeFile) AddOptional(name, feature string, fn func()) {
+	variable := "MK_HAVE_" + identifier(feature)
+	cmake.writeSectionComment(fmt.Sprintf("Optional dependency %s", name))
+	lists := []string{
+		"CMAKE_REQUIRED_DEFINITIONS",
+		"CMAKE_REQUIRED_FLAGS",
+		"CMAKE_REQUIRED_INCLUDES",
+		"CMAKE_REQUIRED_LIBRARIES",
+		requiredVariable("OPTIONS"),
+		"MK_PACKAGE_DEPENDENCIES",
+	}
+	for _, list := range lists {
+		cmake.WriteLine(fmt.Sprintf("set(MK_SAVED_%s ${%s})", list, list))
+	}
+	cmake.WriteLine(fmt.Sprintf("set(%s ON)", variable))
+	cmake.optional = variable
+	fn()
+	cmake.optional = ""
+	cmake.WriteLine(fmt.Sprintf("if((\"${%s}\"))", variable))
+	cmake.WithIndent("  ", func() {
+		cmake.WriteLine(fmt.Sprintf(
+			"message(STATUS \"optional dependency %s: found\")", name,
+		))
+		cmake.AddRequiredDefinition("-D" + variable)
+	})
+	cmake.WriteLine("else()")
+	cmake.WithIndent("  ", func() {
+		cmake.WriteLine(fmt.Sprintf(
+			"message(STATUS \"optional dependency %s: not found\")", name,
+		))
+		for _, list := range lists {
+			cmake.WriteLine(fmt.Sprintf("set(%s ${MK_SAVED_%s})", list, list))
+		}
+	})
+	cmake.WriteLine("endif()")
+}
+
+// IfFindPackage writes code that uses find_package to find |name| and,
+// if all the imported |targets| exist, links with them. When the find
+// module is missing or fails, we run |elseFunc| instead.
+func (cmake *CMakeFile) IfFindPackage(name string, targets []string, elseFunc func()) {
+	cmake.WriteLine(fmt.Sprintf("find_package(%s QUIET)", name))
+	var conditions []string
+	for _, target := range targets {
+		conditions = append(conditions, fmt.Sprintf("(TARGET %s)", target))
+	}
+	cmake.WriteLine(fmt.Sprintf("if(%s)", strings.Join(conditions, " AND ")))
+	cmake.WithIndent("  ", func() {
+		cmake.WriteLine(fmt.Sprintf(
+			"message(STATUS \"find_package: %s: found\")", name,
+		))
+		cmake.WriteLine(fmt.Sprintf(
+			"LIST(APPEND CMAKE_REQUIRED_LIBRARIES %s)", strings.Join(targets, " "),
+		))
+		// Users of our package config need to find it as well
+		cmake.WriteLine(fmt.Sprintf(
+			"LIST(APPEND MK_PACKAGE_DEPENDENCIES %s)", name,
+		))
+	})
+	cmake.WriteLine("else()")
+	cmake.WithIndent("  ", elseFunc)
+	cmake.WriteLine("endif()")
+}
+
+// pkgConfigPrefix returns the prefix of the variables that we use when
+// we find |modules| using pkg-config.
+func pkgConfigPrefix(modules []string) string {
+	return "MK_PKG_" + identifier(strings.Join(modules, "_"))
+}
+
+// IfPkgConfigModules writes code that uses pkg-config to find |modules|
+// and, if found, to compile and link with them. When pkg-config or one
+// of the modules is missing, we run |elseFunc| instead. We also set the
+// <prefix>_USED variable, so that we know whether we used |modules|,
+// since pkg-config caches <prefix>_FOUND.
+func (cmake *CMakeFile) IfPkgConfigModules(modules []string, elseFunc func()) {
+	prefix := pkgConfigPrefix(modules)
+	cmake.WriteLine("find_package(PkgConfig QUIET)")
+	cmake.WriteLine("if((\"${PKG_CONFIG_FOUND}\"))")
+	cmake.WriteLine(fmt.Sprintf(
+		"  pkg_check_modules(%s QUIET %s)", prefix, strings.Join(modules, " "),
+	))
+	cmake.WriteLine("endif()")
+	cmake.WriteLine(fmt.Sprintf("if((\"${%s_FOUND}\"))", prefix))
+	cmake.WithIndent("  ", func() {
+		cmake.WriteLine(fmt.Sprintf(
+			"message(STATUS \"pkg-config: %s: found\")", strings.Join(modules, " "),
+		))
+		cmake.WriteLine(fmt.Sprintf("set(%s_USED ON)", prefix))
+		cmake.WriteLine(fmt.Sprintf(
+			"LIST(APPEND CMAKE_REQUIRED_INCLUDES ${%s_INCLUDE_DIRS})", prefix,
+		))
+		// Only the -D flags are definitions, the others (e.g. -pthread)
+		// are compile options, which the checks also need
+		cmake.WriteLine(fmt.Sprintf("foreach(MK_FLAG ${%s_CFLAGS_OTHER})", prefix))
+		cmake.WriteLine("  if(\"${MK_FLAG}\" MATCHES \"^-D\")")
+		cmake.WriteLine("    LIST(APPEND CMAKE_REQUIRED_DEFINITIONS \"${MK_FLAG}\")")
+		cmake.WriteLine("  else()")
+		cmake.WriteLine(fmt.Sprintf("    LIST(APPEND %s \"${MK_FLAG}\")", requiredVariable("OPTIONS")))
+		cmake.WriteLine("    string(APPEND CMAKE_REQUIRED_FLAGS \" ${MK_FLAG}\")")
+		cmake.WriteLine("  endif()")
+		cmake.WriteLine("endforeach()")
+		cmake.WriteLine(fmt.Sprintf(
+			"LIST(APPEND CMAKE_REQUIRED_LIBRARIES ${%s_LINK_LIBRARIES})", prefix,
+		))
+	})
+	cmake.WriteLine("else()")
+	cmake.WithIndent("  ", elseFunc)
+	cmake.WriteLine("endif()")
+}
+
 // setRestrictiveCompilerFlags sets restrictive compiler flags.
 func (cmake *CMakeFile) setRestrictiveCompilerFlags() {
 	cmake.writeSectionComment("Set restrictive compiler flags")
@@ -256,25 +539,162 @@ func (cmake *CMakeFile) setRestrictiveCompilerFlags() {
 // prepareForCompilingTargets prepares internal variables such that
 // we can compile targets with the required compiler flags.
 func (cmake *CMakeFile) prepareForCompilingTargets() {
+	if cmake.targetBased {
+		return // each target gets its own usage requirements
+	}
 	cmake.writeSectionComment("Prepare for compiling targets")
 	cmake.WriteLine("add_definitions(${CMAKE_REQUIRED_DEFINITIONS})")
+	cmake.WriteLine(fmt.Sprintf("add_compile_options(${%s})", requiredVariable("OPTIONS")))
 	cmake.WriteLine("include_directories(${CMAKE_REQUIRED_INCLUDES})")
 }
 
-// targetLinkLibraries will write the required libraries for target.
-func (cmake *CMakeFile) targetLinkLibraries(name string, libs []string) {
+// AddDependency runs |fn|, which adds the |id| dependency, and records
+// the libraries that |fn| adds, so that targets can link just them.
+func (cmake *CMakeFile) AddDependency(id string, fn func()) {
+	lists := []string{"LIBRARIES"}
+	if cmake.targetBased {
+		lists = append(lists, "INCLUDES", "DEFINITIONS", "OPTIONS")
+	}
+	cmake.writeEmptyLine()
+	cmake.WriteLine(fmt.Sprintf("# Dependency %s", id))
+	for _, list := range lists {
+		cmake.WriteLine(fmt.Sprintf(
+			"list(LENGTH %s MK_%s_BEFORE)", requiredVariable(list), list,
+		))
+	}
+	fn()
+	for _, list := range lists {
+		variable := dependencyVariable(list, id)
+		// SUBLIST fails when the begin index is out of range, which
+		// happens when |fn| did not add anything to the list.
+		cmake.WriteLine(fmt.Sprintf(
+			"list(LENGTH %s MK_%s_AFTER)", requiredVariable(list), list,
+		))
+		cmake.WriteLine(fmt.Sprintf(
+			"if(${MK_%s_BEFORE} LESS ${MK_%s_AFTER})", list, list,
+		))
+		cmake.WriteLine(fmt.Sprintf(
+			"  list(SUBLIST %s ${MK_%s_BEFORE} -1 %s)",
+			requiredVariable(list), list, variable,
+		))
+		cmake.WriteLine("else()")
+		cmake.WriteLine(fmt.Sprintf("  set(%s \"\")", variable))
+		cmake.WriteLine("endif()")
+	}
+}
+
+// requiredVariable returns the variable containing the |list| (e.g.
+// "LIBRARIES") of all the dependencies. CMake has no list of required
+// compile options, hence we use our own variable for "OPTIONS".
+func requiredVariable(list string) string {
+	if list == "OPTIONS" {
+		return "MK_REQUIRED_OPTIONS"
+	}
+	return "CMAKE_REQUIRED_" + list
+}
+
+// dependencyVariable returns the variable containing the |list| (e.g.
+// "LIBRARIES") added by the |id| dependency.
+func dependencyVariable(list, id string) string {
+	return "MK_" + list + "_" + identifier(id)
+}
+
+// targetLinkLibraries will write the required libraries for target. When
+// |dependencies| is nil, we link with the libraries of all dependencies,
+// otherwise just with the libraries of the |dependencies| IDs. With target
+// usage requirements, we also write the include directories and the
+// definitions, using the |scope| scope.
+func (cmake *CMakeFile) targetLinkLibraries(
+	name, scope string, libs []string, dependencies []string,
+) {
+	variables := func(list string) []string {
+		if dependencies == nil {
+			return []string{fmt.Sprintf("${%s}", requiredVariable(list))}
+		}
+		var result []string
+		// A library must come before the libraries it needs
+		for idx := len(dependencies) - 1; idx >= 0; idx-- {
+			result = append(result, fmt.Sprintf(
+				"${%s}", dependencyVariable(list, dependencies[idx]),
+			))
+		}
+		if list == "LIBRARIES" {
+			result = append(result, "${MK_BASE_LIBRARIES}")
+		}
+		return result
+	}
+	if !cmake.targetBased {
+		cmake.WriteLine(fmt.Sprintf("target_link_libraries("))
+		cmake.WriteLine(fmt.Sprintf("  %s", name))
+		if scope == "INTERFACE" {
+			// Interface libraries require the keyword signature
+			cmake.WriteLine(fmt.Sprintf("  %s", scope))
+		}
+		for _, lib := range libs {
+			cmake.WriteLine(fmt.Sprintf("  %s", lib))
+		}
+		for _, variable := range variables("LIBRARIES") {
+			cmake.WriteLine(fmt.Sprintf("  %s", variable))
+		}
+		cmake.WriteLine(fmt.Sprintf(")"))
+		return
+	}
+	cmake.targetUsageRequirements(name, scope, libs, variables)
+}
+
+// targetUsageRequirements writes the include directories, definitions
+// and libraries of target |name| using the |scope| scope. The |variables|
+// function returns the variables containing the include directories, the
+// definitions, the compile options, or the libraries, when passed
+// respectively "INCLUDES", "DEFINITIONS", "OPTIONS", or "LIBRARIES".
+func (cmake *CMakeFile) targetUsageRequirements(
+	name, scope string, libs []string, variables func(string) []string,
+) {
+	if includes := variables("INCLUDES"); len(includes) > 0 {
+		cmake.WriteLine(fmt.Sprintf("target_include_directories("))
+		cmake.WriteLine(fmt.Sprintf("  %s", name))
+		cmake.WriteLine(fmt.Sprintf("  %s", scope))
+		for _, variable := range includes {
+			// Build directory paths must not leak into installed targets
+			cmake.WriteLine(fmt.Sprintf("  \"$<BUILD_INTERFACE:%s>\"", variable))
+		}
+		cmake.WriteLine(fmt.Sprintf(")"))
+	}
+	if definitions := variables("DEFINITIONS"); len(definitions) > 0 {
+		cmake.WriteLine(fmt.Sprintf("target_compile_definitions("))
+		cmake.WriteLine(fmt.Sprintf("  %s", name))
+		cmake.WriteLine(fmt.Sprintf("  %s", scope))
+		for _, variable := range definitions {
+			cmake.WriteLine(fmt.Sprintf("  %s", variable))
+		}
+		cmake.WriteLine(fmt.Sprintf(")"))
+	}
+	if options := variables("OPTIONS"); len(options) > 0 {
+		cmake.WriteLine(fmt.Sprintf("target_compile_options("))
+		cmake.WriteLine(fmt.Sprintf("  %s", name))
+		cmake.WriteLine(fmt.Sprintf("  %s", scope))
+		for _, variable := range options {
+			cmake.WriteLine(fmt.Sprintf("  %s", variable))
+		}
+		cmake.WriteLine(fmt.Sprintf(")"))
+	}
 	cmake.WriteLine(fmt.Sprintf("target_link_libraries("))
 	cmake.WriteLine(fmt.Sprintf("  %s", name))
+	cmake.WriteLine(fmt.Sprintf("  %s", scope))
 	for _, lib := range libs {
 		cmake.WriteLine(fmt.Sprintf("  %s", lib))
 	}
-	cmake.WriteLine(fmt.Sprintf("  ${CMAKE_REQUIRED_LIBRARIES}"))
+	for _, variable := range variables("LIBRARIES") {
+		cmake.WriteLine(fmt.Sprintf("  %s", variable))
+	}
 	cmake.WriteLine(fmt.Sprintf(")"))
 }
 
-// AddExecutable defines an executable to be compiled.
+// AddExecutable defines an executable to be compiled. See targetLinkLibraries
+// for the meaning of |dependencies|.
 func (cmake *CMakeFile) AddExecutable(
-	name string, sources []string, libs []string, install bool,
+	name string, sources []string, libs []string, dependencies []string,
+	install bool,
 ) {
 	cmake.writeSectionComment(name)
 	cmake.WriteLine(fmt.Sprintf("add_executable("))
@@ -283,41 +703,421 @@ func (cmake *CMakeFile) AddExecutable(
 		cmake.WriteLine(fmt.Sprintf("  %s", source))
 	}
 	cmake.WriteLine(fmt.Sprintf(")"))
-	cmake.targetLinkLibraries(name, libs)
+	cmake.targetLinkLibraries(name, "PRIVATE", libs, dependencies)
 	if install {
 		cmake.WriteLine(fmt.Sprintf("install(TARGETS %s DESTINATION bin)", name))
+		cmake.installed = true
 	}
 }
 
-// AddLibrary defines a library to be compiled.
-func (cmake *CMakeFile) AddLibrary(
-	name string, sources []string, libs []string, install bool,
-	headers []string,
-) {
-	cmake.writeSectionComment(name)
-	if sources != nil {
-		cmake.WriteLine(fmt.Sprintf("add_library("))
-		cmake.WriteLine(fmt.Sprintf("  %s", name))
-		for _, source := range sources {
-			cmake.WriteLine(fmt.Sprintf("  %s", source))
+// Library describes a library to be compiled
+type Library struct {
+	// Name is the name of the library
+	Name string
+
+	// Type is "static", "shared", "object", "interface", or empty to
+	// let BUILD_SHARED_LIBS decide between static and shared
+	Type string
+
+	// Sources lists the sources to compile, or is nil for a library
+	// that only consists of headers
+	Sources []string
+
+	// Libs lists the libraries to link with
+	Libs []string
+
+	// Dependencies has the same meaning as in targetLinkLibraries
+	Dependencies []string
+
+	// Install indicates whether to install the library
+	Install bool
+
+	// Headers lists the public headers
+	Headers []string
+
+	// Version is the VERSION of a shared library, if not empty
+	Version string
+
+	// SOVersion is the SOVERSION of a shared library, if not empty
+	SOVersion string
+
+	// PkgConfig describes the pkg-config file to install along with the
+	// library, if not nil
+	PkgConfig *PkgConfig
+}
+
+// PkgConfig describes the pkg-config file of a library
+type PkgConfig struct {
+	// Description is the description of the library
+	Description string
+
+	// URL is the homepage of the library
+	URL string
+
+	// Version is the version of the library
+	Version string
+
+	// Requires lists the pkg-config modules of our own libraries that
+	// the library needs
+	Requires []string
+
+	// Libs lists the linker flags for our own libraries that the library
+	// needs and that do not have a pkg-config module
+	Libs []string
+
+	// Dependencies lists the system libraries that the library needs
+	Dependencies []PkgConfigDependency
+}
+
+// PkgConfigDependency is what a library needs for a system library
+type PkgConfigDependency struct {
+	// Feature is the feature name of an optional dependency, as passed
+	// to AddOptional, or empty for a required dependency
+	Feature string
+
+	// Modules lists the pkg-config modules of the dependency, which we
+	// require when we found the dependency using them
+	Modules []string
+
+	// Libs lists the linker flags of the dependency, which we use when
+	// we found the dependency otherwise
+	Libs []string
+}
+
+// AddLibrary defines a library to be compiled. A shared library hides
+// its symbols by default and gets a <name>_export.h header, generated by
+// GenerateExportHeader, defining the macro to export symbols. A library
+// without sources is an interface library, whose users get the include
+// directories containing its headers and its usage requirements.
+func (cmake *CMakeFile) AddLibrary(lib *Library) {
+	cmake.writeSectionComment(lib.Name)
+	kind := lib.Type
+	if kind == "" && lib.Sources == nil {
+		kind = "interface"
+	}
+	scope := "PUBLIC"
+	if kind == "interface" {
+		scope = "INTERFACE"
+	}
+	cmake.WriteLine(fmt.Sprintf("add_library("))
+	cmake.WriteLine(fmt.Sprintf("  %s", lib.Name))
+	if kind != "" {
+		cmake.WriteLine(fmt.Sprintf("  %s", strings.ToUpper(kind)))
+	}
+	for _, source := range lib.Sources {
+		cmake.WriteLine(fmt.Sprintf("  %s", source))
+	}
+	cmake.WriteLine(fmt.Sprintf(")"))
+	cmake.targetLinkLibraries(lib.Name, scope, lib.Libs, lib.Dependencies)
+	if kind == "interface" && len(lib.Headers) > 0 {
+		cmake.headersIncludeDirectories(lib)
+	}
+	if kind == "shared" {
+		cmake.sharedLibraryProperties(lib)
+	}
+	if kind != "object" {
+		// Use the same name of the exported target
+		cmake.WriteLine(fmt.Sprintf(
+			"add_library(%s::%s ALIAS %s)", cmake.project, lib.Name, lib.Name,
+		))
+	}
+	if lib.Install && kind != "object" {
+		cmake.WriteLine(fmt.Sprintf("install("))
+		cmake.WriteLine(fmt.Sprintf("  TARGETS %s", lib.Name))
+		cmake.WriteLine(fmt.Sprintf("  EXPORT %sTargets", cmake.project))
+		if kind != "interface" {
+			cmake.WriteLine(fmt.Sprintf("  RUNTIME DESTINATION bin"))
+			cmake.WriteLine(fmt.Sprintf("  LIBRARY DESTINATION lib"))
+			cmake.WriteLine(fmt.Sprintf("  ARCHIVE DESTINATION lib"))
 		}
+		cmake.WriteLine(fmt.Sprintf("  INCLUDES DESTINATION include"))
 		cmake.WriteLine(fmt.Sprintf(")"))
-		cmake.targetLinkLibraries(name, libs)
-		if install {
-			cmake.WriteLine(fmt.Sprintf("install(TARGETS %s DESTINATION lib)", name))
-		}
+		cmake.exported, cmake.installed = true, true
 	}
-	if headers != nil && install {
+	if lib.Install && kind != "object" && lib.PkgConfig != nil {
+		cmake.installPkgConfig(lib, kind)
+	}
+	if lib.Headers != nil && lib.Install {
 		cmake.WriteLine(fmt.Sprintf("install("))
 		cmake.WriteLine(fmt.Sprintf("  FILES"))
-		for _, header := range headers {
+		for _, header := range lib.Headers {
 			cmake.WriteLine(fmt.Sprintf("  %s", header))
 		}
+		if kind == "shared" {
+			cmake.WriteLine(fmt.Sprintf("  %s", exportHeader(lib)))
+		}
 		cmake.WriteLine(fmt.Sprintf("  DESTINATION include"))
 		cmake.WriteLine(fmt.Sprintf(")"))
+		cmake.installed = true
 	}
 }
 
+// installPkgConfig generates and installs the <name>.pc pkg-config file
+// of the |lib| library of type |kind|. Users of an interface library need
+// all its requirements, while users of a compiled library only need them
+// when linking statically. We require the pkg-config modules of a system
+// library only when we found it using them, because other systems may not
+// have them, and otherwise we use its linker flags.
+func (cmake *CMakeFile) installPkgConfig(lib *Library, kind string) {
+	pc := lib.PkgConfig
+	filename := fmt.Sprintf("${CMAKE_CURRENT_BINARY_DIR}/%s.pc", lib.Name)
+	cmake.WriteLine(fmt.Sprintf(
+		"set(MK_PC_REQUIRES \"%s\")", strings.Join(pc.Requires, " "),
+	))
+	cmake.WriteLine(fmt.Sprintf("set(MK_PC_LIBS \"%s\")", strings.Join(pc.Libs, " ")))
+	for _, dep := range pc.Dependencies {
+		indent := ""
+		if dep.Feature != "" {
+			cmake.WriteLine(fmt.Sprintf(
+				"if((\"${MK_HAVE_%s}\"))", identifier(dep.Feature),
+			))
+			indent = "  "
+		}
+		cmake.WithIndent(indent, func() {
+			cmake.pkgConfigDependency(dep)
+		})
+		if dep.Feature != "" {
+			cmake.WriteLine("endif()")
+		}
+	}
+	cmake.WriteLine("string(APPEND MK_PC_LIBS \" ${CMAKE_THREAD_LIBS_INIT}\")")
+	suffix := ".private"
+	if kind == "interface" {
+		suffix = ""
+	}
+	description := pc.Description
+	if description == "" {
+		description = lib.Name
+	}
+	cmake.WriteLine(fmt.Sprintf("file(WRITE \"%s\" \"prefix=${CMAKE_INSTALL_PREFIX}", filename))
+	cmake.WriteLine("libdir=\\${prefix}/lib")
+	cmake.WriteLine("includedir=\\${prefix}/include")
+	cmake.writeEmptyLine()
+	cmake.WriteLine(fmt.Sprintf("Name: %s", lib.Name))
+	cmake.WriteLine(fmt.Sprintf("Description: %s", cmakeQuote(description)))
+	if pc.URL != "" {
+		cmake.WriteLine(fmt.Sprintf("URL: %s", cmakeQuote(pc.URL)))
+	}
+	if pc.Version != "" {
+		cmake.WriteLine(fmt.Sprintf("Version: %s", pc.Version))
+	}
+	cmake.WriteLine(fmt.Sprintf("Requires%s: ${MK_PC_REQUIRES}", suffix))
+	cmake.WriteLine("Cflags: -I\\${includedir}")
+	if kind != "interface" {
+		cmake.WriteLine(fmt.Sprintf("Libs: -L\\${libdir} -l%s", lib.Name))
+	}
+	cmake.WriteLine(fmt.Sprintf("Libs%s: ${MK_PC_LIBS}", suffix))
+	cmake.WriteLine("\")")
+	cmake.WriteLine(fmt.Sprintf("install(FILES \"%s\" DESTINATION lib/pkgconfig)", filename))
+}
+
+// pkgConfigDependency writes code appending to MK_PC_REQUIRES or to
+// MK_PC_LIBS what a library needs for the |dep| system library.
+func (cmake *CMakeFile) pkgConfigDependency(dep PkgConfigDependency) {
+	appendLibs := func() {
+		if len(dep.Libs) > 0 {
+			cmake.WriteLine(fmt.Sprintf(
+				"string(APPEND MK_PC_LIBS \" %s\")", strings.Join(dep.Libs, " "),
+			))
+		}
+	}
+	if len(dep.Modules) <= 0 {
+		appendLibs()
+		return
+	}
+	cmake.WriteLine(fmt.Sprintf(
+		"if((\"${%s_USED}\"))", pkgConfigPrefix(dep.Modules),
+	))
+	cmake.WithIndent("  ", func() {
+		cmake.WriteLine(fmt.Sprintf(
+			"string(APPEND MK_PC_REQUIRES \" %s\")", strings.Join(dep.Modules, " "),
+		))
+	})
+	if len(dep.Libs) > 0 {
+		cmake.WriteLine("else()")
+		cmake.WithIndent("  ", appendLibs)
+	}
+	cmake.WriteLine("endif()")
+}
+
+// cmakeQuote escapes |s| for use inside a CMake quoted argument.
+func cmakeQuote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`).Replace(s)
+}
+
+// headersIncludeDirectories makes the directories containing the headers
+// of the |lib| interface library available to its users. Once installed,
+// the headers are in the include directory.
+func (cmake *CMakeFile) headersIncludeDirectories(lib *Library) {
+	cmake.WriteLine(fmt.Sprintf("target_include_directories("))
+	cmake.WriteLine(fmt.Sprintf("  %s", lib.Name))
+	cmake.WriteLine(fmt.Sprintf("  INTERFACE"))
+	seen := make(map[string]bool)
+	for _, header := range lib.Headers {
+		dir := path.Join("${CMAKE_CURRENT_SOURCE_DIR}", path.Dir(header))
+		if !seen[dir] {
+			seen[dir] = true
+			cmake.WriteLine(fmt.Sprintf("  \"$<BUILD_INTERFACE:%s>\"", dir))
+		}
+	}
+	cmake.WriteLine(fmt.Sprintf("  \"$<INSTALL_INTERFACE:include>\""))
+	cmake.WriteLine(fmt.Sprintf(")"))
+}
+
+// exportHeader returns the path of the export header of |lib|. This is
+// the default of GenerateExportHeader, which uses the lowercase name.
+func exportHeader(lib *Library) string {
+	return fmt.Sprintf("${CMAKE_CURRENT_BINARY_DIR}/%s_export.h", strings.ToLower(lib.Name))
+}
+
+// sharedLibraryProperties sets the version, the symbol visibility and
+// the export header of the |lib| shared library.
+func (cmake *CMakeFile) sharedLibraryProperties(lib *Library) {
+	cmake.WriteLine(fmt.Sprintf("set_target_properties("))
+	cmake.WriteLine(fmt.Sprintf("  %s", lib.Name))
+	cmake.WriteLine(fmt.Sprintf("  PROPERTIES"))
+	if lib.Version != "" {
+		cmake.WriteLine(fmt.Sprintf("  VERSION %s", lib.Version))
+	}
+	if lib.SOVersion != "" {
+		cmake.WriteLine(fmt.Sprintf("  SOVERSION %s", lib.SOVersion))
+	}
+	cmake.WriteLine(fmt.Sprintf("  C_VISIBILITY_PRESET hidden"))
+	cmake.WriteLine(fmt.Sprintf("  CXX_VISIBILITY_PRESET hidden"))
+	cmake.WriteLine(fmt.Sprintf("  VISIBILITY_INLINES_HIDDEN ON"))
+	cmake.WriteLine(fmt.Sprintf(")"))
+	cmake.WriteLine(fmt.Sprintf("include(GenerateExportHeader)"))
+	cmake.WriteLine(fmt.Sprintf(
+		"generate_export_header(%s EXPORT_FILE_NAME \"%s\")", lib.Name, exportHeader(lib),
+	))
+	cmake.WriteLine(fmt.Sprintf(
+		"target_include_directories(%s PUBLIC \"$<BUILD_INTERFACE:${CMAKE_CURRENT_BINARY_DIR}>\")",
+		lib.Name,
+	))
+}
+
+// AddPackageConfig installs the exported targets, if any, along with the
+// <project>Config.cmake file, which finds the packages that the exported
+// targets need, so that users can find_package(<project>) and link with
+// the <project>::<library> targets. When the project has a version, we
+// also install <project>ConfigVersion.cmake.
+func (cmake *CMakeFile) AddPackageConfig() {
+	version := cmake.metadata.Version
+	if !cmake.exported {
+		return
+	}
+	cmake.writeSectionComment("Package config")
+	destination := fmt.Sprintf("lib/cmake/%s", cmake.project)
+	config := fmt.Sprintf("${CMAKE_CURRENT_BINARY_DIR}/%sConfig.cmake", cmake.project)
+	configVersion := fmt.Sprintf(
+		"${CMAKE_CURRENT_BINARY_DIR}/%sConfigVersion.cmake", cmake.project,
+	)
+	cmake.WriteLine(fmt.Sprintf("install("))
+	cmake.WriteLine(fmt.Sprintf("  EXPORT %sTargets", cmake.project))
+	cmake.WriteLine(fmt.Sprintf("  NAMESPACE %s::", cmake.project))
+	cmake.WriteLine(fmt.Sprintf("  DESTINATION %s", destination))
+	cmake.WriteLine(fmt.Sprintf(")"))
+	cmake.WriteLine(fmt.Sprintf(
+		"file(WRITE \"%s\" \"include(CMakeFindDependencyMacro)\\n\")", config,
+	))
+	cmake.WriteLine("list(REMOVE_DUPLICATES MK_PACKAGE_DEPENDENCIES)")
+	cmake.WriteLine("foreach(MK_PACKAGE ${MK_PACKAGE_DEPENDENCIES})")
+	cmake.WriteLine(fmt.Sprintf(
+		"  file(APPEND \"%s\" \"find_dependency(${MK_PACKAGE})\\n\")", config,
+	))
+	cmake.WriteLine("endforeach()")
+	cmake.WriteLine(fmt.Sprintf(
+		"file(APPEND \"%s\" \"include(\\\"\\${CMAKE_CURRENT_LIST_DIR}/%sTargets.cmake\\\")\\n\")",
+		config, cmake.project,
+	))
+	if version != "" {
+		cmake.WriteLine("include(CMakePackageConfigHelpers)")
+		cmake.WriteLine(fmt.Sprintf("write_basic_package_version_file("))
+		cmake.WriteLine(fmt.Sprintf("  \"%s\"", configVersion))
+		cmake.WriteLine(fmt.Sprintf("  VERSION %s", version))
+		cmake.WriteLine(fmt.Sprintf("  COMPATIBILITY SameMajorVersion"))
+		cmake.WriteLine(fmt.Sprintf(")"))
+	}
+	cmake.WriteLine(fmt.Sprintf("install("))
+	cmake.WriteLine(fmt.Sprintf("  FILES"))
+	cmake.WriteLine(fmt.Sprintf("  \"%s\"", config))
+	if version != "" {
+		cmake.WriteLine(fmt.Sprintf("  \"%s\"", configVersion))
+	}
+	cmake.WriteLine(fmt.Sprintf("  DESTINATION %s", destination))
+	cmake.WriteLine(fmt.Sprintf(")"))
+	if version != "" {
+		cmake.WriteLine(fmt.Sprintf(
+			"install(FILES \"${CMAKE_CURRENT_BINARY_DIR}/%s_version.h\" DESTINATION include)",
+			cmake.project,
+		))
+	}
+}
+
+// AddVersionHeader generates the <project>_version.h header, defining the
+// <PROJECT>_VERSION string and the <PROJECT>_VERSION_MAJOR, _MINOR and
+// _PATCH numbers. Call it before adding targets, so that they can include
+// it. AddPackageConfig installs it along with the installed libraries.
+func (cmake *CMakeFile) AddVersionHeader() {
+	if cmake.metadata.Version == "" {
+		return
+	}
+	cmake.writeSectionComment("Version header")
+	prefix := identifier(cmake.project) + "_VERSION"
+	filename := fmt.Sprintf("${CMAKE_CURRENT_BINARY_DIR}/%s_version.h", cmake.project)
+	cmake.WriteLine("foreach(MK_PART MAJOR MINOR PATCH)")
+	cmake.WriteLine("  if(\"${PROJECT_VERSION_${MK_PART}}\" STREQUAL \"\")")
+	cmake.WriteLine("    set(PROJECT_VERSION_${MK_PART} 0)")
+	cmake.WriteLine("  endif()")
+	cmake.WriteLine("endforeach()")
+	// Write a temporary file and copy it, such that we do not touch the
+	// header, causing a rebuild, when the version does not change.
+	cmake.WriteLine(fmt.Sprintf("file(WRITE \"%s.tmp\" \"// Autogenerated by `mkbuild`; DO NOT EDIT!", filename))
+	cmake.WriteLine(fmt.Sprintf("#ifndef %s_H", prefix))
+	cmake.WriteLine(fmt.Sprintf("#define %s_H", prefix))
+	cmake.WriteLine(fmt.Sprintf("#define %s \\\"${PROJECT_VERSION}\\\"", prefix))
+	cmake.WriteLine(fmt.Sprintf("#define %s_MAJOR ${PROJECT_VERSION_MAJOR}", prefix))
+	cmake.WriteLine(fmt.Sprintf("#define %s_MINOR ${PROJECT_VERSION_MINOR}", prefix))
+	cmake.WriteLine(fmt.Sprintf("#define %s_PATCH ${PROJECT_VERSION_PATCH}", prefix))
+	cmake.WriteLine("#endif")
+	cmake.WriteLine("\")")
+	cmake.WriteLine(fmt.Sprintf("configure_file(\"%s.tmp\" \"%s\" COPYONLY)", filename, filename))
+	cmake.WriteLine("include_directories(${CMAKE_CURRENT_BINARY_DIR})")
+}
+
+// AddCPack configures CPack to package what we install using the project
+// metadata. Call it after all the install() commands. We do nothing for
+// projects without version that do not install anything.
+func (cmake *CMakeFile) AddCPack() {
+	if !cmake.installed && cmake.metadata.Version == "" {
+		return
+	}
+	cmake.writeSectionComment("Packaging")
+	cmake.WriteLine(fmt.Sprintf("set(CPACK_PACKAGE_NAME \"%s\")", cmake.project))
+	if cmake.metadata.Description != "" {
+		cmake.WriteLine(fmt.Sprintf(
+			"set(CPACK_PACKAGE_DESCRIPTION_SUMMARY \"%s\")",
+			cmakeQuote(cmake.metadata.Description),
+		))
+	}
+	if cmake.metadata.HomepageURL != "" {
+		cmake.WriteLine(fmt.Sprintf(
+			"set(CPACK_PACKAGE_HOMEPAGE_URL \"%s\")",
+			cmakeQuote(cmake.metadata.HomepageURL),
+		))
+	}
+	if cmake.metadata.License != "" {
+		cmake.WriteLine(fmt.Sprintf(
+			"set(CPACK_RPM_PACKAGE_LICENSE \"%s\")", cmakeQuote(cmake.metadata.License),
+		))
+	}
+	cmake.WriteLine("if(EXISTS \"${CMAKE_CURRENT_SOURCE_DIR}/LICENSE\")")
+	cmake.WriteLine("  set(CPACK_RESOURCE_FILE_LICENSE \"${CMAKE_CURRENT_SOURCE_DIR}/LICENSE\")")
+	cmake.WriteLine("endif()")
+	cmake.WriteLine("set(CPACK_SOURCE_IGNORE_FILES \"/\\\\.git/;/build/\")")
+	cmake.WriteLine("include(CPack)")
+}
+
 // AddScript defines a script to be installed.
 func (cmake *CMakeFile) AddScript(name string, install bool) {
 	if install {
@@ -327,6 +1127,7 @@ func (cmake *CMakeFile) AddScript(name string, install bool) {
 		cmake.WriteLine(fmt.Sprintf("  %s", name))
 		cmake.WriteLine(fmt.Sprintf("  DESTINATION bin"))
 		cmake.WriteLine(fmt.Sprintf(")"))
+		cmake.installed = true
 	}
 }
 
@@ -338,26 +1139,32 @@ func (cmake *CMakeFile) AddTest(name, command string) {
 	cmake.WriteLine(fmt.Sprintf(")"))
 }
 
-// AddSingleHeaderDependency adds a single-header dependency
-func (cmake *CMakeFile) AddSingleHeaderDependency(SHA256, URL string) {
+// AddSingleHeaderDependency adds a single-header dependency. The
+// optional |fallbacks| URLs are tried when |URL| does not work.
+func (cmake *CMakeFile) AddSingleHeaderDependency(
+	SHA256, URL string, fallbacks ...string,
+) {
 	headerName := filepath.Base(URL)
 	cmake.writeSectionComment(headerName)
 	dirname := "${CMAKE_BINARY_DIR}/.mkbuild/include"
 	filename := dirname + "/" + headerName
 	cmake.mkdirAll(dirname)
-	cmake.download(filename, SHA256, URL)
+	cmake.download(filename, SHA256, URL, fallbacks)
 	cmake.AddRequiredIncludeDir(dirname)
 	cmake.RequireHeaderExists(headerName)
 }
 
-// AddSingleFileAsset adds a single-file asset to the build
-func (cmake *CMakeFile) AddSingleFileAsset(SHA256, URL string) {
+// AddSingleFileAsset adds a single-file asset to the build. The
+// optional |fallbacks| URLs are tried when |URL| does not work.
+func (cmake *CMakeFile) AddSingleFileAsset(
+	SHA256, URL string, fallbacks ...string,
+) {
 	assetName := filepath.Base(URL)
 	cmake.writeSectionComment(assetName)
 	dirname := "${CMAKE_BINARY_DIR}/.mkbuild/data"
 	filename := dirname + "/" + assetName
 	cmake.mkdirAll(dirname)
-	cmake.download(filename, SHA256, URL)
+	cmake.download(filename, SHA256, URL, fallbacks)
 }
 
 // IfWIN32 allows you to generate WIN32 / !WIN32 specific code.
@@ -401,7 +1208,7 @@ func (cmake *CMakeFile) if32bit(func32 func(), func64 func()) {
 
 // Win32InstallPrebuilt installs a prebuilt Windows package.
 func (cmake *CMakeFile) Win32InstallPrebuilt(pkg *prebuilt.Package) {
-	cmake.DownloadAndExtractArchive(pkg.SHA256, pkg.URL)
+	cmake.DownloadAndExtractArchive(pkg.SHA256, pkg.URL, pkg.FallbackURLs...)
 	basedir := "${CMAKE_BINARY_DIR}/.mkbuild/download/" + pkg.Prefix + "/${MK_WIN32_ARCH}"
 	includedirname := basedir + "/include"
 	cmake.AddRequiredIncludeDir(includedirname)
@@ -413,14 +1220,17 @@ func (cmake *CMakeFile) Win32InstallPrebuilt(pkg *prebuilt.Package) {
 	}
 }
 
-// DownloadAndExtractArchive downloads and extracts and archive
-func (cmake *CMakeFile) DownloadAndExtractArchive(SHA256, URL string) {
+// DownloadAndExtractArchive downloads and extracts and archive. The
+// optional |fallbacks| URLs are tried when |URL| does not work.
+func (cmake *CMakeFile) DownloadAndExtractArchive(
+	SHA256, URL string, fallbacks ...string,
+) {
 	archiveName := filepath.Base(URL)
 	cmake.writeSectionComment(archiveName)
 	dirname := "${CMAKE_BINARY_DIR}/.mkbuild/download"
 	filename := dirname + "/" + archiveName
 	cmake.mkdirAll(dirname)
-	cmake.download(filename, SHA256, URL)
+	cmake.download(filename, SHA256, URL, fallbacks)
 	filepathname := dirname + "/" + archiveName
 	cmake.untar(filepathname, dirname)
 }
@@ -431,17 +1241,8 @@ func (cmake *CMakeFile) FinalizeCompilerFlags() {
 	cmake.prepareForCompilingTargets()
 }
 
-// Close writes CMakeLists.txt in the current directory.
-func (cmake *CMakeFile) Close() {
-	filename := "CMakeLists.txt"
-	filep, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		log.WithError(err).Fatalf("os.Open failed for: %s", filename)
-	}
-	defer filep.Close()
-	_, err = filep.WriteString(cmake.output.String())
-	if err != nil {
-		log.WithError(err).Fatalf("filep.WriteString failed for: %s", filename)
-	}
-	log.Infof("Written %s", filename)
+// WriteTo writes the generated CMakeLists.txt content to |w|.
+func (cmake *CMakeFile) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, cmake.output.String())
+	return int64(n), err
 }
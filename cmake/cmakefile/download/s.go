@@ -0,0 +1,125 @@
+// Package download contains the CMake code used to download dependencies
+package download
+
+// S contains CMake functions to download dependencies. MKBuildDownload
+// uses the copy vendored by `mkbuild vendor`, if any, then the copy in
+// the per-user cache shared by all build directories, if any, and otherwise
+// downloads the file, trying each mirror and URL in order, and adds it
+// to the cache. In all cases, it verifies the SHA256. When MKBUILD_OFFLINE
+// is ON, MKBuildCheckOffline fails reporting all the dependencies that
+// are neither vendored nor cached, and we never download anything.
+var S = `option(MKBUILD_USE_VENDORED "Use the dependencies in MKBUILD_VENDOR_DIR" ON)
+option(MKBUILD_OFFLINE "Only use vendored or cached dependencies" OFF)
+set(MKBUILD_VENDOR_DIR "${CMAKE_SOURCE_DIR}/third_party" CACHE PATH
+  "Directory containing the dependencies vendored by 'mkbuild vendor'")
+if(DEFINED ENV{MKBUILD_CACHE_DIR})
+  set(MK_DEFAULT_CACHE_DIR "$ENV{MKBUILD_CACHE_DIR}")
+elseif(DEFINED ENV{XDG_CACHE_HOME})
+  set(MK_DEFAULT_CACHE_DIR "$ENV{XDG_CACHE_HOME}/mkbuild")
+elseif(WIN32 AND DEFINED ENV{LOCALAPPDATA})
+  file(TO_CMAKE_PATH "$ENV{LOCALAPPDATA}/mkbuild/cache" MK_DEFAULT_CACHE_DIR)
+elseif(DEFINED ENV{HOME})
+  set(MK_DEFAULT_CACHE_DIR "$ENV{HOME}/.cache/mkbuild")
+else()
+  set(MK_DEFAULT_CACHE_DIR "${CMAKE_BINARY_DIR}/.mkbuild/cache")
+endif()
+set(MKBUILD_CACHE_DIR "${MK_DEFAULT_CACHE_DIR}" CACHE PATH
+  "Directory where builds share downloaded dependencies")
+set(MKBUILD_MIRROR "$ENV{MKBUILD_MIRROR}" CACHE STRING
+  "Semicolon separated URL prefixes to try before the upstream URLs")
+set(MKBUILD_PROJECT_MIRRORS "")
+
+function(MKBuildFindLocal VENDORED SHA256 OUTPUT)
+  set(MK_VENDORED "${MKBUILD_VENDOR_DIR}/${VENDORED}")
+  if(MKBUILD_USE_VENDORED AND EXISTS "${MK_VENDORED}")
+    file(SHA256 "${MK_VENDORED}" MK_VENDORED_SHA256)
+    if(NOT ("${MK_VENDORED_SHA256}" STREQUAL "${SHA256}"))
+      message(FATAL_ERROR "SHA256 mismatch for ${MK_VENDORED}: expected "
+        "${SHA256}, found ${MK_VENDORED_SHA256}; please run 'mkbuild vendor'")
+    endif()
+    set(${OUTPUT} "${MK_VENDORED}" PARENT_SCOPE)
+    return()
+  endif()
+  set(MK_CACHED "${MKBUILD_CACHE_DIR}/sha256/${SHA256}")
+  if(EXISTS "${MK_CACHED}")
+    file(SHA256 "${MK_CACHED}" MK_CACHED_SHA256)
+    if("${MK_CACHED_SHA256}" STREQUAL "${SHA256}")
+      set(${OUTPUT} "${MK_CACHED}" PARENT_SCOPE)
+      return()
+    endif()
+    message(STATUS "ignoring corrupt cache entry: ${MK_CACHED}")
+  endif()
+  set(${OUTPUT} "" PARENT_SCOPE)
+endfunction()
+
+function(MKBuildCheckOffline)
+  if(NOT MKBUILD_OFFLINE)
+    return()
+  endif()
+  set(MK_ARGS ${ARGN})
+  list(LENGTH MK_ARGS MK_COUNT)
+  math(EXPR MK_LAST "${MK_COUNT} - 1")
+  set(MK_MISSING "")
+  foreach(MK_INDEX RANGE 0 ${MK_LAST} 2)
+    list(GET MK_ARGS ${MK_INDEX} MK_VENDORED)
+    math(EXPR MK_INDEX "${MK_INDEX} + 1")
+    list(GET MK_ARGS ${MK_INDEX} MK_SHA256)
+    MKBuildFindLocal("${MK_VENDORED}" "${MK_SHA256}" MK_LOCAL)
+    if("${MK_LOCAL}" STREQUAL "")
+      string(APPEND MK_MISSING "\n  ${MK_VENDORED} (SHA256 ${MK_SHA256})")
+    endif()
+  endforeach()
+  if(NOT ("${MK_MISSING}" STREQUAL ""))
+    message(FATAL_ERROR "MKBUILD_OFFLINE is ON and these dependencies are "
+      "neither in ${MKBUILD_VENDOR_DIR} nor in ${MKBUILD_CACHE_DIR}:"
+      "${MK_MISSING}")
+  endif()
+endfunction()
+
+function(MKBuildDownload DESTINATION SHA256 VENDORED)
+  MKBuildFindLocal("${VENDORED}" "${SHA256}" MK_LOCAL)
+  if(NOT ("${MK_LOCAL}" STREQUAL ""))
+    message(STATUS "local copy: ${MK_LOCAL}")
+    configure_file("${MK_LOCAL}" "${DESTINATION}" COPYONLY)
+    return()
+  endif()
+  if(MKBUILD_OFFLINE)
+    message(FATAL_ERROR "MKBUILD_OFFLINE is ON and ${VENDORED} is missing")
+  endif()
+  set(MK_SOURCES "")
+  foreach(MK_MIRROR ${MKBUILD_MIRROR} ${MKBUILD_PROJECT_MIRRORS})
+    string(REGEX REPLACE "/+$" "" MK_MIRROR "${MK_MIRROR}")
+    list(APPEND MK_SOURCES "${MK_MIRROR}/${VENDORED}")
+  endforeach()
+  list(APPEND MK_SOURCES ${ARGN})
+  set(MK_FAILURES "")
+  foreach(MK_SOURCE ${MK_SOURCES})
+    message(STATUS "download: ${MK_SOURCE}")
+    file(DOWNLOAD "${MK_SOURCE}" "${DESTINATION}.part"
+      STATUS MK_STATUS
+      TLS_VERIFY ON)
+    list(GET MK_STATUS 0 MK_STATUS_CODE)
+    if(NOT ("${MK_STATUS_CODE}" EQUAL 0))
+      list(GET MK_STATUS 1 MK_STATUS_REASON)
+      string(APPEND MK_FAILURES "\n  ${MK_SOURCE}: ${MK_STATUS_REASON}")
+    else()
+      file(SHA256 "${DESTINATION}.part" MK_DOWNLOADED_SHA256)
+      if("${MK_DOWNLOADED_SHA256}" STREQUAL "${SHA256}")
+        file(RENAME "${DESTINATION}.part" "${DESTINATION}")
+        # Copy then rename, so that concurrent builds never see partial files
+        set(MK_CACHED "${MKBUILD_CACHE_DIR}/sha256/${SHA256}")
+        string(RANDOM LENGTH 16 MK_SUFFIX)
+        file(MAKE_DIRECTORY "${MKBUILD_CACHE_DIR}/sha256")
+        configure_file("${DESTINATION}" "${MK_CACHED}.${MK_SUFFIX}" COPYONLY)
+        file(RENAME "${MK_CACHED}.${MK_SUFFIX}" "${MK_CACHED}")
+        return()
+      endif()
+      string(APPEND MK_FAILURES
+        "\n  ${MK_SOURCE}: SHA256 mismatch (found ${MK_DOWNLOADED_SHA256})")
+    endif()
+    file(REMOVE "${DESTINATION}.part")
+  endforeach()
+  message(FATAL_ERROR "cannot download ${VENDORED} with SHA256 ${SHA256}:"
+    "${MK_FAILURES}")
+endfunction()
+`
@@ -20,6 +20,9 @@ type Package struct {
 	// URL is the URL of the tarball
 	URL string
 
+	// FallbackURLs are tried in order when URL does not work
+	FallbackURLs []string
+
 	// Prefix is the prefix to strip from the tarball to reach the
 	// arch dependent directories x86 and x64
 	Prefix string
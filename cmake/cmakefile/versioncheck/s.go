@@ -0,0 +1,75 @@
+// Package versioncheck contains the CMake code used to check the
+// version of system libraries
+package versioncheck
+
+// S contains a CMake function that checks whether the version of the
+// NAME system library satisfies all the CONSTRAINTS (e.g. ">=7.58"). We
+// find out the version by compiling and running a program that prints
+// MACRO, defined by HEADER, or, failing that, using pkg-config to query
+// the version of the first PKG_CONFIG module. With RESULT, we set the
+// RESULT variable to OFF, rather than failing, when the check fails.
+var S = `function(MKBuildCheckVersion NAME)
+  cmake_parse_arguments(MK "" "HEADER;MACRO;RESULT" "CONSTRAINTS;PKG_CONFIG" ${ARGN})
+  string(MAKE_C_IDENTIFIER "${NAME}" MK_ID)
+  set(MK_VERSION "")
+  set(MK_FAILURE "")
+  if(NOT ("${MK_HEADER}" STREQUAL ""))
+    set(MK_DIR "${CMAKE_BINARY_DIR}/.mkbuild/version/${MK_ID}")
+    file(WRITE "${MK_DIR}/main.cpp"
+      "#include <${MK_HEADER}>\n#include <iostream>\n"
+      "int main() { std::cout << ${MK_MACRO} << std::endl; }\n")
+    try_run(MK_RUN_${MK_ID} MK_COMPILE_${MK_ID} "${MK_DIR}" "${MK_DIR}/main.cpp"
+      CMAKE_FLAGS "-DINCLUDE_DIRECTORIES=${CMAKE_REQUIRED_INCLUDES}"
+      COMPILE_DEFINITIONS ${CMAKE_REQUIRED_DEFINITIONS}
+      LINK_LIBRARIES ${CMAKE_REQUIRED_LIBRARIES}
+      RUN_OUTPUT_VARIABLE MK_OUTPUT)
+    if(MK_COMPILE_${MK_ID} AND ("${MK_RUN_${MK_ID}}" EQUAL 0))
+      string(REGEX MATCH "[0-9]+(\\.[0-9]+)*" MK_VERSION "${MK_OUTPUT}")
+    endif()
+  endif()
+  if(("${MK_VERSION}" STREQUAL "") AND MK_PKG_CONFIG)
+    find_package(PkgConfig QUIET)
+    if(("${PKG_CONFIG_FOUND}"))
+      list(GET MK_PKG_CONFIG 0 MK_MODULE)
+      execute_process(
+        COMMAND "${PKG_CONFIG_EXECUTABLE}" --modversion "${MK_MODULE}"
+        OUTPUT_VARIABLE MK_OUTPUT
+        RESULT_VARIABLE MK_EXIT_CODE
+        OUTPUT_STRIP_TRAILING_WHITESPACE
+        ERROR_QUIET)
+      if("${MK_EXIT_CODE}" EQUAL 0)
+        string(REGEX MATCH "[0-9]+(\\.[0-9]+)*" MK_VERSION "${MK_OUTPUT}")
+      endif()
+    endif()
+  endif()
+  string(REPLACE ";" "," MK_WANTED "${MK_CONSTRAINTS}")
+  if("${MK_VERSION}" STREQUAL "")
+    set(MK_FAILURE "${NAME}: cannot find out its version, but ${MK_WANTED} is required")
+  endif()
+  foreach(MK_CONSTRAINT ${MK_CONSTRAINTS})
+    if(NOT ("${MK_FAILURE}" STREQUAL ""))
+      break()
+    endif()
+    string(REGEX MATCH "^(>=|<=|!=|>|<|=)(.*)$" MK_MATCH "${MK_CONSTRAINT}")
+    set(MK_OP "${CMAKE_MATCH_1}")
+    set(MK_WANTED_VERSION "${CMAKE_MATCH_2}")
+    if(("${MK_OP}" STREQUAL ">=" AND "${MK_VERSION}" VERSION_LESS "${MK_WANTED_VERSION}") OR
+       ("${MK_OP}" STREQUAL ">" AND NOT "${MK_VERSION}" VERSION_GREATER "${MK_WANTED_VERSION}") OR
+       ("${MK_OP}" STREQUAL "<=" AND "${MK_VERSION}" VERSION_GREATER "${MK_WANTED_VERSION}") OR
+       ("${MK_OP}" STREQUAL "<" AND NOT "${MK_VERSION}" VERSION_LESS "${MK_WANTED_VERSION}") OR
+       ("${MK_OP}" STREQUAL "=" AND NOT "${MK_VERSION}" VERSION_EQUAL "${MK_WANTED_VERSION}") OR
+       ("${MK_OP}" STREQUAL "!=" AND "${MK_VERSION}" VERSION_EQUAL "${MK_WANTED_VERSION}"))
+      set(MK_FAILURE "${NAME}: found version ${MK_VERSION}, but ${MK_WANTED} is required")
+    endif()
+  endforeach()
+  if(NOT ("${MK_FAILURE}" STREQUAL ""))
+    if("${MK_RESULT}" STREQUAL "")
+      message(FATAL_ERROR "${MK_FAILURE}")
+    endif()
+    message(STATUS "${MK_FAILURE}")
+    set(${MK_RESULT} OFF PARENT_SCOPE)
+    return()
+  endif()
+  message(STATUS "${NAME}: version ${MK_VERSION} satisfies ${MK_WANTED}")
+endfunction()
+`
@@ -0,0 +1,171 @@
+package deps
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Constraint is a version constraint (e.g. ">=7.58")
+type Constraint struct {
+	// Op is one of ">=", ">", "<=", "<", "=", and "!="
+	Op string
+
+	// Version is the version to compare with
+	Version string
+}
+
+// constraintOps lists the operators, longest first so that we do not
+// mistake ">=" for ">".
+var constraintOps = []string{">=", "<=", "!=", "==", ">", "<", "="}
+
+// constraintVersionRe matches the version of a constraint.
+var constraintVersionRe = regexp.MustCompile(`^v?[0-9A-Za-z._+-]+$`)
+
+// ParseConstraints parses comma separated version constraints (e.g.
+// ">=7.58, <8"). A version without operator means "=".
+func ParseConstraints(s string) ([]Constraint, error) {
+	var constraints []Constraint
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		c := Constraint{Op: "="}
+		for _, op := range constraintOps {
+			if strings.HasPrefix(field, op) {
+				c.Op, field = op, strings.TrimSpace(field[len(op):])
+				break
+			}
+		}
+		if c.Op == "==" {
+			c.Op = "="
+		}
+		c.Version = field
+		if !constraintVersionRe.MatchString(c.Version) {
+			return nil, fmt.Errorf("invalid version constraint: %q", s)
+		}
+		constraints = append(constraints, c)
+	}
+	return constraints, nil
+}
+
+// String returns the constraint as a string (e.g. ">=7.58").
+func (c Constraint) String() string {
+	return c.Op + c.Version
+}
+
+// Allows returns whether |version| satisfies the constraint.
+func (c Constraint) Allows(version string) bool {
+	cmp := CompareVersions(version, c.Version)
+	switch c.Op {
+	case ">=":
+		return cmp >= 0
+	case ">":
+		return cmp > 0
+	case "<=":
+		return cmp <= 0
+	case "<":
+		return cmp < 0
+	case "!=":
+		return cmp != 0
+	}
+	return cmp == 0
+}
+
+// Satisfies returns whether |version| satisfies all the |constraints|.
+func Satisfies(version string, constraints []Constraint) bool {
+	for _, c := range constraints {
+		if !c.Allows(version) {
+			return false
+		}
+	}
+	return true
+}
+
+// JoinConstraints returns |constraints| as a comma separated string.
+func JoinConstraints(constraints []Constraint) string {
+	var s []string
+	for _, c := range constraints {
+		s = append(s, c.String())
+	}
+	return strings.Join(s, ",")
+}
+
+// Ref is a reference to a dependency, possibly with version constraints
+type Ref struct {
+	// ID is the dependency ID (e.g. "github.com/nlohmann/json")
+	ID string
+
+	// Version is the requested version or empty for the latest
+	Version string
+
+	// Constraints are the requested version constraints, if any
+	Constraints []Constraint
+}
+
+// ParseRef parses a dependency reference, which is either the dependency
+// ID, which selects the latest version, or the ID followed by "@" and a
+// specific version (e.g. "github.com/nlohmann/json@v3.7.3").
+func ParseRef(s string) Ref {
+	id, version := SplitRef(s)
+	return Ref{ID: id, Version: version}
+}
+
+// String returns the reference without constraints (e.g.
+// "github.com/nlohmann/json@v3.7.3").
+func (ref Ref) String() string {
+	if ref.Version != "" {
+		return ref.ID + "@" + ref.Version
+	}
+	return ref.ID
+}
+
+// Refs is a list of dependency references. In YAML, each item is either
+// a reference (e.g. "github.com/curl/curl") or a mapping from a reference
+// to version constraints (e.g. `github.com/curl/curl: ">=7.58"`).
+type Refs []Ref
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (refs *Refs) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.SequenceNode {
+		return fmt.Errorf("line %d: expected a list of dependencies", node.Line)
+	}
+	*refs = Refs{} // distinguish an empty list from a missing one
+	for _, item := range node.Content {
+		switch {
+		case item.Kind == yaml.ScalarNode:
+			*refs = append(*refs, ParseRef(item.Value))
+		case item.Kind == yaml.MappingNode && len(item.Content) == 2 &&
+			item.Content[0].Kind == yaml.ScalarNode &&
+			item.Content[1].Kind == yaml.ScalarNode:
+			key, value := item.Content[0], item.Content[1]
+			constraints, err := ParseConstraints(value.Value)
+			if err != nil {
+				return fmt.Errorf("line %d: %s", value.Line, err.Error())
+			}
+			ref := ParseRef(key.Value)
+			ref.Constraints = constraints
+			*refs = append(*refs, ref)
+		default:
+			return fmt.Errorf(
+				"line %d: expected a dependency or a dependency mapped to version constraints",
+				item.Line)
+		}
+	}
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (refs Refs) MarshalYAML() (interface{}, error) {
+	var items []interface{}
+	for _, ref := range refs {
+		if len(ref.Constraints) > 0 {
+			items = append(items, map[string]string{
+				ref.String(): JoinConstraints(ref.Constraints),
+			})
+			continue
+		}
+		items = append(items, ref.String())
+	}
+	return items, nil
+}
@@ -0,0 +1,174 @@
+package deps
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestCompareVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"v1.0.0", "1.0.0", 0},
+		{"1.0.0", "1.0.1", -1},
+		{"1.0.10", "1.0.9", 1},
+		{"1.10", "1.9.9", 1},
+		{"2", "10", -1},
+		{"1.0", "1.0.1", -1},
+		{"1.0.1", "1.0", 1},
+		{"7.58.0", "7.58", 1},
+		{"1.1.1d", "1.1.1c", 1},
+		{"1.1.1", "1.1.1a", -1},
+		{"20190520205742", "20190101000000", 1},
+	} {
+		if got := CompareVersions(tc.a, tc.b); got != tc.want {
+			t.Errorf("CompareVersions(%q, %q): expected %d, got %d", tc.a, tc.b, tc.want, got)
+		}
+		if got := CompareVersions(tc.b, tc.a); got != -tc.want {
+			t.Errorf("CompareVersions(%q, %q): expected %d, got %d", tc.b, tc.a, -tc.want, got)
+		}
+	}
+}
+
+func TestParseConstraints(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want []Constraint
+	}{
+		{">=7.58", []Constraint{{">=", "7.58"}}},
+		{">= 7.58", []Constraint{{">=", "7.58"}}},
+		{"1.2.3", []Constraint{{"=", "1.2.3"}}},
+		{"==1.2.3", []Constraint{{"=", "1.2.3"}}},
+		{">=3.7, <4", []Constraint{{">=", "3.7"}, {"<", "4"}}},
+		{"!=v1.0,>0.9,<=2", []Constraint{{"!=", "v1.0"}, {">", "0.9"}, {"<=", "2"}}},
+	} {
+		got, err := ParseConstraints(tc.s)
+		if err != nil {
+			t.Errorf("ParseConstraints(%q): %s", tc.s, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseConstraints(%q): expected %v, got %v", tc.s, tc.want, got)
+		}
+	}
+	for _, s := range []string{"", ">=", "~1", ">=1,", "=>1", "1 2"} {
+		if _, err := ParseConstraints(s); err == nil {
+			t.Errorf("ParseConstraints(%q): expected an error", s)
+		}
+	}
+}
+
+func TestSatisfies(t *testing.T) {
+	for _, tc := range []struct {
+		version     string
+		constraints string
+		want        bool
+	}{
+		{"7.58.0", ">=7.58", true},
+		{"7.57.9", ">=7.58", false},
+		{"7.58", ">7.58", false},
+		{"7.58.1", ">7.58", true},
+		{"3.9.1", ">=3.7, <4", true},
+		{"4.0", ">=3.7, <4", false},
+		{"v1.0.0", "1.0.0", true},
+		{"1.0.0", "!=1.0.0", false},
+		{"1.0.0", "<=1.0.0", true},
+	} {
+		constraints, err := ParseConstraints(tc.constraints)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Satisfies(tc.version, constraints); got != tc.want {
+			t.Errorf("Satisfies(%q, %q): expected %v, got %v",
+				tc.version, tc.constraints, tc.want, got)
+		}
+	}
+	if !Satisfies("1.0", nil) {
+		t.Error("no constraints must always be satisfied")
+	}
+}
+
+func TestJoinConstraints(t *testing.T) {
+	constraints, err := ParseConstraints(">= 3.7 , <4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := JoinConstraints(constraints); got != ">=3.7,<4" {
+		t.Fatalf("expected >=3.7,<4, got %s", got)
+	}
+}
+
+func TestParseRef(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want Ref
+	}{
+		{"github.com/nlohmann/json", Ref{ID: "github.com/nlohmann/json"}},
+		{"github.com/nlohmann/json@v3.7.3",
+			Ref{ID: "github.com/nlohmann/json", Version: "v3.7.3"}},
+	} {
+		got := ParseRef(tc.s)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseRef(%q): expected %+v, got %+v", tc.s, tc.want, got)
+		}
+		if got.String() != tc.s {
+			t.Errorf("expected %q, got %q", tc.s, got.String())
+		}
+	}
+}
+
+func TestRefsYAML(t *testing.T) {
+	data := `
+- github.com/nlohmann/json@v3.7.3
+- github.com/curl/curl: ">=7.58, <8"
+`
+	var refs Refs
+	if err := yaml.Unmarshal([]byte(data), &refs); err != nil {
+		t.Fatal(err)
+	}
+	want := Refs{
+		{ID: "github.com/nlohmann/json", Version: "v3.7.3"},
+		{ID: "github.com/curl/curl", Constraints: []Constraint{{">=", "7.58"}, {"<", "8"}}},
+	}
+	if !reflect.DeepEqual(refs, want) {
+		t.Fatalf("expected %+v, got %+v", want, refs)
+	}
+	out, err := yaml.Marshal(refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again Refs
+	if err := yaml.Unmarshal(out, &again); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, want) {
+		t.Fatalf("expected %+v, got %+v", want, again)
+	}
+}
+
+func TestRefsYAMLErrors(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		want string
+	}{
+		{"github.com/curl/curl", "expected a list of dependencies"},
+		{"- github.com/curl/curl: \"~7\"", "invalid version constraint"},
+		{"- {a: \">=1\", b: \">=2\"}", "expected a dependency or a dependency mapped"},
+		{"- [github.com/curl/curl]", "expected a dependency or a dependency mapped"},
+	} {
+		var refs Refs
+		err := yaml.Unmarshal([]byte(tc.data), &refs)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: expected an error containing %q, got %v", tc.data, tc.want, err)
+		}
+	}
+	var refs Refs
+	if err := yaml.Unmarshal([]byte("[]"), &refs); err != nil || refs == nil {
+		t.Fatalf("an empty list must not be nil: %v, %v", refs, err)
+	}
+}
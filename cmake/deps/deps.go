@@ -2,127 +2,586 @@
 package deps
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
 	"github.com/apex/log"
 	"github.com/measurement-kit/mkbuild/cmake/cmakefile"
+	"github.com/measurement-kit/mkbuild/cmake/cmakefile/prebuilt"
+	"gopkg.in/yaml.v3"
 )
 
-// All contains all the dependencies that we know of.
-var All = map[string]func(*cmakefile.CMakeFile){
-	"github.com/adishavit/argh": func(cmake *cmakefile.CMakeFile) {
-		cmake.AddSingleHeaderDependency(
-			"ddb7dfc18dcf90149735b76fb2cff101067453a1df1943a6911233cb7085980c",
-			"https://raw.githubusercontent.com/adishavit/argh/v1.3.1/argh.h",
-		)
-	},
-	"github.com/c-ares/c-ares": func(cmake *cmakefile.CMakeFile) {
-		// TODO(bassosimone): implement c-ares support for Windows
-		log.Warn("github.com/c-ares/c-ares: not supported on Windows")
-		cmake.RequireHeaderExists("ares.h")
-		cmake.RequireLibraryExists("cares", "ares_process")
-		cmake.AddRequiredLibrary("cares")
-	},
-	"github.com/catchorg/catch2": func(cmake *cmakefile.CMakeFile) {
-		cmake.AddSingleHeaderDependency(
-			"914690be7714fed1f228679a0e379b4e1f6d7d66f88ac20335b7853ff1a8bc55",
-			"https://github.com/catchorg/Catch2/releases/download/v2.11.1/catch.hpp",
-		)
-	},
-	"github.com/curl/curl": func(cmake *cmakefile.CMakeFile) {
-		// TODO(bassosimone): implement curl support for Windows
-		cmake.RequireHeaderExists("curl/curl.h")
-		cmake.RequireLibraryExists("curl", "curl_easy_init")
-		cmake.AddRequiredLibrary("curl")
-	},
-	"github.com/howardhinnant/date": func(cmake *cmakefile.CMakeFile) {
+// EnvVar is the environment variable containing the path of a
+// registry file that overrides or extends the default registry.
+const EnvVar = "MKBUILD_REGISTRY"
+
+// SchemaVersion is the version of the registry format we understand.
+const SchemaVersion = 1
+
+// Kind is the kind of a dependency
+type Kind string
+
+const (
+	// SingleHeader is a single header downloaded at configure time
+	SingleHeader = Kind("single-header")
+
+	// Archive is a tarball downloaded and extracted at configure time
+	Archive = Kind("archive")
+
+	// SystemLibrary is a library that must be already installed
+	SystemLibrary = Kind("system-library")
+
+	// Prebuilt is a library downloaded as a prebuilt tarball on Windows
+	// and that must be already installed on other systems
+	Prebuilt = Kind("prebuilt")
+
+	// Asset is a data file downloaded at configure time
+	Asset = Kind("asset")
+)
+
+// Library contains info on a library to check for and link with
+type Library struct {
+	// Name is the name of the library
+	Name string `yaml:"name"`
+
+	// Func is a function that the library must export
+	Func string `yaml:"func"`
+}
+
+// Package is a package found using CMake's find_package
+type Package struct {
+	// Name is the name of the package (e.g. "OpenSSL")
+	Name string `yaml:"name"`
+
+	// Targets lists the imported targets to link with (e.g. "OpenSSL::SSL")
+	Targets []string `yaml:"targets"`
+}
+
+// VersionProbe is a macro containing the version of a library
+type VersionProbe struct {
+	// Header is the header defining the macro (e.g. "curl/curl.h")
+	Header string `yaml:"header"`
+
+	// Macro is the macro expanding to the version (e.g. "LIBCURL_VERSION")
+	Macro string `yaml:"macro"`
+}
+
+// Pin is a specific version of a dependency
+type Pin struct {
+	// Version is the version (e.g. "v3.7.3")
+	Version string `yaml:"version"`
+
+	// URL is the URL from which to download this version
+	URL string `yaml:"url"`
+
+	// SHA256 is the SHA256 of the file at URL
+	SHA256 string `yaml:"sha256"`
+
+	// FallbackURLs are tried in order when URL does not work
+	FallbackURLs []string `yaml:"fallback_urls,omitempty"`
+}
+
+// Dependency describes how to add a dependency to the build
+type Dependency struct {
+	// Kind is the kind of dependency
+	Kind Kind `yaml:"kind"`
+
+	// URL is the URL from which to download the dependency when
+	// it does not have Versions
+	URL string `yaml:"url,omitempty"`
+
+	// SHA256 is the SHA256 of the file at URL
+	SHA256 string `yaml:"sha256,omitempty"`
+
+	// FallbackURLs are tried in order when URL does not work
+	FallbackURLs []string `yaml:"fallback_urls,omitempty"`
+
+	// Versions lists the known versions of the dependency. When you do
+	// not ask for a specific version, we use the latest one.
+	Versions []Pin `yaml:"versions,omitempty"`
+
+	// URLTemplate is a text/template that expands to the URL of the
+	// version in {{.Version}}. `mkbuild deps update` uses it to add new
+	// versions of dependencies hosted on GitHub.
+	URLTemplate string `yaml:"url_template,omitempty"`
+
+	// Prefix is the prefix to strip from a prebuilt tarball to reach
+	// the arch dependent directories x86 and x64
+	Prefix string `yaml:"prefix,omitempty"`
+
+	// Headers lists the headers that must exist
+	Headers []string `yaml:"headers,omitempty"`
+
+	// Libraries lists the libraries that must exist
+	Libraries []Library `yaml:"libraries,omitempty"`
+
+	// FindPackage is the package providing a system library, whose
+	// imported targets we prefer to any other strategy
+	FindPackage *Package `yaml:"find_package,omitempty"`
+
+	// PkgConfig lists the pkg-config modules providing a system library,
+	// which we prefer to probing for Headers and Libraries
+	PkgConfig []string `yaml:"pkg_config,omitempty"`
+
+	// VersionProbe tells how to find out the version of a system library
+	// by compiling and running a program printing a macro
+	VersionProbe *VersionProbe `yaml:"version_probe,omitempty"`
+
+	// Homebrew is the Homebrew prefix to use on macOS, if it exists
+	Homebrew string `yaml:"homebrew,omitempty"`
+
+	// Warning is a warning to print when using the dependency
+	Warning string `yaml:"warning,omitempty"`
+
+	// Dependencies lists the references (e.g. "github.com/curl/curl")
+	// of the dependencies that this dependency needs
+	Dependencies Refs `yaml:"dependencies,omitempty"`
+}
+
+// Registry contains all the dependencies that we know of
+type Registry struct {
+	// Version is the version of the registry format
+	Version int `yaml:"version"`
+
+	// Revision identifies the content of the registry
+	Revision string `yaml:"revision,omitempty"`
+
+	// Dependencies maps a dependency ID to the dependency
+	Dependencies map[string]*Dependency `yaml:"dependencies"`
+}
+
+// Parse parses a registry from |data| read from |filename|.
+func Parse(filename string, data []byte) (*Registry, error) {
+	registry := &Registry{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(registry); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+	if registry.Version != SchemaVersion {
+		return nil, fmt.Errorf("%s: unsupported registry version: %d",
+			filename, registry.Version)
+	}
+	for id, dep := range registry.Dependencies {
+		if dep == nil {
+			return nil, fmt.Errorf("%s: %s: missing definition", filename, id)
+		}
+		if err := dep.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %s: %s", filename, id, err.Error())
+		}
+	}
+	return registry, nil
+}
+
+// Validate makes sure that |dep| contains the fields its kind needs.
+func (dep *Dependency) Validate() error {
+	for _, pin := range dep.Versions {
+		if pin.Version == "" || pin.URL == "" || pin.SHA256 == "" {
+			return fmt.Errorf("versions require version, url and sha256")
+		}
+	}
+	if dep.VersionProbe != nil {
+		if dep.VersionProbe.Header == "" || dep.VersionProbe.Macro == "" {
+			return fmt.Errorf("version_probe requires header and macro")
+		}
+	}
+	if dep.FindPackage != nil {
+		if dep.FindPackage.Name == "" || len(dep.FindPackage.Targets) <= 0 {
+			return fmt.Errorf("find_package requires name and targets")
+		}
+	}
+	downloadable := len(dep.Versions) > 0 || (dep.URL != "" && dep.SHA256 != "")
+	switch dep.Kind {
+	case SingleHeader, Archive, Asset:
+		if !downloadable {
+			return fmt.Errorf("%s requires url and sha256 or versions", dep.Kind)
+		}
+	case Prebuilt:
+		if !downloadable || len(dep.Headers) != 1 {
+			return fmt.Errorf("%s requires url, sha256 and one header", dep.Kind)
+		}
+	case SystemLibrary:
+		if len(dep.Headers) <= 0 && len(dep.Libraries) <= 0 &&
+			len(dep.PkgConfig) <= 0 && dep.FindPackage == nil {
+			return fmt.Errorf(
+				"%s requires headers, libraries, pkg_config or find_package", dep.Kind)
+		}
+		if len(dep.Versions) > 0 {
+			return fmt.Errorf("%s cannot have versions", dep.Kind)
+		}
+	default:
+		return fmt.Errorf("unknown kind: %q", dep.Kind)
+	}
+	return nil
+}
+
+// Default returns the registry embedded into mkbuild.
+func Default() *Registry {
+	registry, err := Parse("<default registry>", []byte(defaultRegistry))
+	if err != nil {
+		panic(err) // this is a bug in mkbuild
+	}
+	return registry
+}
+
+// LoadFile loads the registry file at |path|.
+func LoadFile(path string) (*Registry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, data)
+}
+
+// Load returns the default registry extended with the registry files
+// at |paths|. Empty paths are ignored. Dependencies in later files
+// override dependencies with the same ID in former files.
+func Load(paths ...string) (*Registry, error) {
+	registry := Default()
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		other, err := LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		registry.Merge(other)
+	}
+	return registry, nil
+}
+
+// WriteTo writes |registry| in YAML format to |w|.
+func (registry *Registry) WriteTo(w io.Writer) (int64, error) {
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(registry); err != nil {
+		return 0, err
+	}
+	if err := encoder.Close(); err != nil {
+		return 0, err
+	}
+	return buffer.WriteTo(w)
+}
+
+// Merge adds the dependencies of |other| to |registry|, replacing the
+// dependencies that have the same ID.
+func (registry *Registry) Merge(other *Registry) {
+	if registry.Dependencies == nil {
+		registry.Dependencies = make(map[string]*Dependency)
+	}
+	for id, dep := range other.Dependencies {
+		registry.Dependencies[id] = dep
+	}
+	if other.Revision != "" {
+		registry.Revision += "+" + other.Revision
+	}
+}
+
+// Latest returns the latest version of |dep| or nil if |dep| does not
+// have any version.
+func (dep *Dependency) Latest() *Pin {
+	var latest *Pin
+	for idx := range dep.Versions {
+		pin := &dep.Versions[idx]
+		if latest == nil || CompareVersions(pin.Version, latest.Version) > 0 {
+			latest = pin
+		}
+	}
+	return latest
+}
+
+// Resolved is a dependency resolved to a specific version
+type Resolved struct {
+	// ID is the dependency ID
+	ID string
+
+	// Version is the selected version, or empty if the dependency
+	// does not have versions
+	Version string
+
+	// URL is the URL from which to download the selected version
+	URL string
+
+	// SHA256 is the SHA256 of the file at URL
+	SHA256 string
+
+	// FallbackURLs are tried in order when URL does not work
+	FallbackURLs []string
+
+	// Dependency is the dependency definition
+	Dependency *Dependency
+
+	// Revision is the revision of the registry that resolved it
+	Revision string
+
+	// Constraints are the version constraints to check at configure
+	// time, which only applies to system libraries
+	Constraints []Constraint
+}
+
+// Ref returns the reference selecting exactly |resolved|.
+func (resolved *Resolved) Ref() string {
+	if resolved.Version == "" {
+		return resolved.ID
+	}
+	return resolved.ID + "@" + resolved.Version
+}
+
+// Artifact returns the artifact downloaded at configure time for
+// |resolved|, if any, and whether it is only needed on Windows.
+func (resolved *Resolved) Artifact() (artifact *cmakefile.Artifact, win32 bool) {
+	if resolved.URL == "" {
+		return nil, false
+	}
+	artifact = &cmakefile.Artifact{SHA256: resolved.SHA256, URL: resolved.URL}
+	return artifact, resolved.Dependency.Kind == Prebuilt
+}
+
+// setPin selects the version described by |pin|.
+func (resolved *Resolved) setPin(pin *Pin) {
+	resolved.Version = pin.Version
+	resolved.URL = pin.URL
+	resolved.SHA256 = pin.SHA256
+	resolved.FallbackURLs = pin.FallbackURLs
+}
+
+// URLs returns the URL followed by the FallbackURLs.
+func (resolved *Resolved) URLs() []string {
+	return append([]string{resolved.URL}, resolved.FallbackURLs...)
+}
+
+// SplitRef splits a dependency reference like "github.com/nlohmann/json@v3.7.3"
+// into the ID and the version. The version is empty when missing.
+func SplitRef(ref string) (id, version string) {
+	if idx := strings.LastIndex(ref, "@"); idx >= 0 {
+		return ref[:idx], ref[idx+1:]
+	}
+	return ref, ""
+}
+
+// Resolve resolves the |ref| dependency reference, honouring its version
+// and its version constraints, if any.
+func (registry *Registry) Resolve(ref Ref) (*Resolved, error) {
+	return registry.resolve(ref.ID, ref.Version, ref.Constraints)
+}
+
+// resolve resolves |id| to |version|, or, if |version| is empty, to the
+// latest version satisfying |constraints|. Dependencies without versions
+// must be system libraries, whose version we check at configure time.
+func (registry *Registry) resolve(
+	id, version string, constraints []Constraint,
+) (*Resolved, error) {
+	dep, found := registry.Dependencies[id]
+	if !found || dep == nil {
+		return nil, fmt.Errorf("unknown dependency: %s", id)
+	}
+	resolved := &Resolved{
+		ID:           id,
+		URL:          dep.URL,
+		SHA256:       dep.SHA256,
+		FallbackURLs: dep.FallbackURLs,
+		Dependency:   dep,
+		Revision:     registry.Revision,
+	}
+	if len(dep.Versions) <= 0 && len(constraints) > 0 {
+		if version != "" || dep.Kind != SystemLibrary {
+			return nil, fmt.Errorf(
+				"%s: cannot check version constraints: no known versions", id)
+		}
+		if dep.VersionProbe == nil && len(dep.PkgConfig) <= 0 {
+			return nil, fmt.Errorf(
+				"%s: cannot check version constraints without pkg_config or version_probe", id)
+		}
+		resolved.Constraints = constraints
+		return resolved, nil
+	}
+	var known []string
+	for _, pin := range dep.Versions {
+		known = append(known, pin.Version)
+	}
+	sort.Slice(known, func(i, j int) bool {
+		return CompareVersions(known[i], known[j]) < 0
+	})
+	if version == "" {
+		var latest *Pin
+		for idx := range dep.Versions {
+			pin := &dep.Versions[idx]
+			if Satisfies(pin.Version, constraints) &&
+				(latest == nil || CompareVersions(pin.Version, latest.Version) > 0) {
+				latest = pin
+			}
+		}
+		if latest != nil {
+			resolved.setPin(latest)
+		} else if len(constraints) > 0 {
+			return nil, fmt.Errorf("%s: no known version satisfies %s (known versions: %s)",
+				id, JoinConstraints(constraints), strings.Join(known, ", "))
+		}
+		return resolved, nil
+	}
+	for _, pin := range dep.Versions {
+		if pin.Version == version {
+			if !Satisfies(version, constraints) {
+				return nil, fmt.Errorf("%s: version %s does not satisfy %s",
+					id, version, JoinConstraints(constraints))
+			}
+			resolved.setPin(&pin)
+			return resolved, nil
+		}
+	}
+	if len(known) <= 0 {
+		return nil, fmt.Errorf("%s: cannot select version %s: no known versions", id, version)
+	}
+	return nil, fmt.Errorf("%s: unknown version %s (known versions: %s)",
+		id, version, strings.Join(known, ", "))
+}
+
+// Has returns whether |id| is a known dependency.
+func (registry *Registry) Has(id string) bool {
+	_, found := registry.Dependencies[id]
+	return found
+}
+
+// IDs returns the sorted IDs of all the known dependencies.
+func (registry *Registry) IDs() []string {
+	var ids []string
+	for id := range registry.Dependencies {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Apply adds |resolved| to |cmake|.
+func (resolved *Resolved) Apply(cmake *cmakefile.CMakeFile) {
+	dep := resolved.Dependency
+	if dep.Warning != "" {
+		log.Warnf("%s: %s", resolved.ID, dep.Warning)
+	}
+	switch dep.Kind {
+	case SingleHeader:
 		cmake.AddSingleHeaderDependency(
-			"07aa75752540023ccccab178ed193f536c9d032cbbda997159af9f339d331eda",
-			"https://raw.githubusercontent.com/HowardHinnant/date/v2.4.1/include/date/date.h",
-		)
-	},
-	"github.com/maxmind/libmaxminddb": func(cmake *cmakefile.CMakeFile) {
-		// TODO(bassosimone): implement libmaxminddb support for Windows
-		cmake.RequireHeaderExists("maxminddb.h")
-		cmake.RequireLibraryExists("maxminddb", "MMDB_open")
-		cmake.AddRequiredLibrary("maxminddb")
-	},
-	"github.com/measurement-kit/generic-assets": func(cmake *cmakefile.CMakeFile) {
+			resolved.SHA256, resolved.URL, resolved.FallbackURLs...)
+	case Archive:
 		cmake.DownloadAndExtractArchive(
-			"70d590c20b2ed31fd43cc63709b267672fecfeac7e908d11e845664ddd43b04f",
-			"https://github.com/measurement-kit/generic-assets/releases/download/20190520205742/generic-assets-20190520205742.tar.gz",
-		)
-	},
-	"github.com/measurement-kit/mkbouncer": func(cmake *cmakefile.CMakeFile) {
-		cmake.AddSingleHeaderDependency(
-			"7c0a810d58fdbc1ffdacb0eed442d31ebff819e49d1222b81619fe3c582a028c",
-			"https://raw.githubusercontent.com/measurement-kit/mkbouncer/v0.3.0/mkbouncer.hpp",
-		)
-	},
-	"github.com/measurement-kit/mkcollector": func(cmake *cmakefile.CMakeFile) {
-		cmake.AddSingleHeaderDependency(
-			"9c81a0c4212eb411be380d2d4b0bd3ada1d70b23f6039b17fe82d3d4ccad1774",
-			"https://raw.githubusercontent.com/measurement-kit/mkcollector/v0.6.0/mkcollector.hpp",
-		)
-	},
-	"github.com/measurement-kit/mkcurl": func(cmake *cmakefile.CMakeFile) {
-		cmake.AddSingleHeaderDependency(
-			"cb58b85ccdf8d9f3b559ccab7d2f31cad4f8aba774e9953534e32373d415ec94",
-			"https://raw.githubusercontent.com/measurement-kit/mkcurl/v0.12.0/mkcurl.hpp",
-		)
-	},
-	"github.com/measurement-kit/mkdata": func(cmake *cmakefile.CMakeFile) {
-		cmake.AddSingleHeaderDependency(
-			"96bb0384ecd7231a861111d8818a560b7d5ca83316cf7946a4f1a352db6ecfe3",
-			"https://raw.githubusercontent.com/measurement-kit/mkdata/v0.3.0/mkdata.hpp",
-		)
-	},
-	"github.com/measurement-kit/mkiplookup": func(cmake *cmakefile.CMakeFile) {
-		cmake.AddSingleHeaderDependency(
-			"a815119250d09be5eff332289f90fd872910f3dc9f29bb4a5fe60e272b38174f",
-			"https://raw.githubusercontent.com/measurement-kit/mkiplookup/v0.2.0/mkiplookup.hpp",
-		)
-	},
-	"github.com/measurement-kit/mkmmdb": func(cmake *cmakefile.CMakeFile) {
-		cmake.AddSingleHeaderDependency(
-			"c1cdcf2980c977a0d4abbdd447ddc19eefdfe6faa42b3be752d50f29930d4a87",
-			"https://raw.githubusercontent.com/measurement-kit/mkmmdb/v0.4.0/mkmmdb.hpp",
-		)
-	},
-	"github.com/measurement-kit/mkmock": func(cmake *cmakefile.CMakeFile) {
-		cmake.AddSingleHeaderDependency(
-			"f07bc063a2e64484482f986501003e45ead653ea3f53fadbdb45c17a51d916d2",
-			"https://raw.githubusercontent.com/measurement-kit/mkmock/v0.2.0/mkmock.hpp",
-		)
-	},
-	"github.com/measurement-kit/mkuuid4": func(cmake *cmakefile.CMakeFile) {
-		cmake.AddSingleHeaderDependency(
-			"5b6b4445697d9beb6ad5310d98b7743c2ffe8266cdec79df0a7a429dcfc247ac",
-			"https://raw.githubusercontent.com/measurement-kit/mkuuid4/v0.1.0/mkuuid4.hpp",
-		)
-	},
-	"github.com/nlohmann/json": func(cmake *cmakefile.CMakeFile) {
-		cmake.AddSingleHeaderDependency(
-			"3b5d2b8f8282b80557091514d8ab97e27f9574336c804ee666fda673a9b59926",
-			"https://raw.githubusercontent.com/nlohmann/json/v3.7.3/single_include/nlohmann/json.hpp",
-		)
-	},
-	"github.com/openssl/openssl": func(cmake *cmakefile.CMakeFile) {
-		// TODO(bassosimone): implement openssl support for Windows
+			resolved.SHA256, resolved.URL, resolved.FallbackURLs...)
+	case Asset:
+		cmake.AddSingleFileAsset(
+			resolved.SHA256, resolved.URL, resolved.FallbackURLs...)
+	case SystemLibrary:
+		dep.requireSystemLibrary(cmake)
+		if len(resolved.Constraints) > 0 {
+			resolved.checkVersion(cmake)
+		}
+	case Prebuilt:
+		cmake.IfWIN32(func() {
+			pkg := &prebuilt.Package{
+				SHA256:       resolved.SHA256,
+				URL:          resolved.URL,
+				FallbackURLs: resolved.FallbackURLs,
+				Prefix:       dep.Prefix,
+				HeaderName:   dep.Headers[0],
+			}
+			for _, lib := range dep.Libraries {
+				pkg.Libs = append(pkg.Libs, prebuilt.Library{
+					Name: lib.Name,
+					Func: lib.Func,
+				})
+			}
+			cmake.Win32InstallPrebuilt(pkg)
+		}, func() {
+			dep.requireSystemLibrary(cmake)
+		})
+	}
+}
+
+// ApplyOptional is like Apply, except that a missing dependency does not
+// stop the build. When the dependency is found, we define MK_HAVE_<NAME>,
+// where NAME derives from the Feature (e.g. MK_HAVE_C_ARES).
+func (resolved *Resolved) ApplyOptional(cmake *cmakefile.CMakeFile) {
+	cmake.AddOptional(resolved.ID, resolved.Feature(), func() {
+		resolved.Apply(cmake)
+	})
+}
+
+// Feature returns the feature name of an optional dependency, i.e., the
+// last component of the ID (e.g. "c-ares").
+func (resolved *Resolved) Feature() string {
+	return path.Base(resolved.ID)
+}
+
+// PkgConfig returns what the users of a library linking with |resolved|
+// need, or nil when they do not need anything.
+func (resolved *Resolved) PkgConfig() *cmakefile.PkgConfigDependency {
+	dep := resolved.Dependency
+	if dep.Kind != SystemLibrary && dep.Kind != Prebuilt {
+		return nil
+	}
+	pc := &cmakefile.PkgConfigDependency{Modules: dep.PkgConfig}
+	for _, lib := range dep.Libraries {
+		pc.Libs = append(pc.Libs, "-l"+lib.Name)
+	}
+	return pc
+}
+
+// checkVersion adds code checking the Constraints of a system library.
+func (resolved *Resolved) checkVersion(cmake *cmakefile.CMakeFile) {
+	var constraints []string
+	for _, c := range resolved.Constraints {
+		constraints = append(constraints, c.Op+strings.TrimPrefix(c.Version, "v"))
+	}
+	var header, macro string
+	if probe := resolved.Dependency.VersionProbe; probe != nil {
+		header, macro = probe.Header, probe.Macro
+	}
+	cmake.CheckVersion(resolved.ID, constraints, header, macro,
+		resolved.Dependency.PkgConfig)
+}
+
+// requireSystemLibrary adds code requiring an installed library. We use
+// the imported targets of find_package, if possible, then pkg-config, if
+// possible, and otherwise we probe for the headers and the libraries.
+func (dep *Dependency) requireSystemLibrary(cmake *cmakefile.CMakeFile) {
+	if dep.Homebrew != "" {
 		cmake.IfAPPLE(func() {
 			// Automatically use Homebrew, if available
-			cmake.WriteLine(`if(EXISTS "/usr/local/opt/openssl@1.1")`)
+			cmake.WriteLine(fmt.Sprintf(`if(EXISTS "%s")`, dep.Homebrew))
 			cmake.WithIndent("  ", func() {
-				cmake.WriteLine(`  set(CMAKE_C_FLAGS "${CMAKE_C_FLAGS} -I/usr/local/opt/openssl@1.1/include")`)
-				cmake.WriteLine(`  set(CMAKE_CXX_FLAGS "${CMAKE_CXX_FLAGS} -I/usr/local/opt/openssl@1.1/include")`)
-				cmake.WriteLine(`  set(CMAKE_EXE_LINKER_FLAGS "${CMAKE_EXE_LINKER_FLAGS} -L/usr/local/opt/openssl@1.1/lib")`)
-				cmake.WriteLine(`  set(CMAKE_SHARED_LINKER_FLAGS "${CMAKE_SHARED_LINKER_FLAGS} -L/usr/local/opt/openssl@1.1/lib")`)
+				cmake.WriteLine(fmt.Sprintf(`  list(APPEND CMAKE_PREFIX_PATH "%s")`, dep.Homebrew))
+				cmake.WriteLine(fmt.Sprintf(`  set(ENV{PKG_CONFIG_PATH} "%s/lib/pkgconfig:$ENV{PKG_CONFIG_PATH}")`, dep.Homebrew))
+				cmake.WriteLine(fmt.Sprintf(`  set(CMAKE_C_FLAGS "${CMAKE_C_FLAGS} -I%s/include")`, dep.Homebrew))
+				cmake.WriteLine(fmt.Sprintf(`  set(CMAKE_CXX_FLAGS "${CMAKE_CXX_FLAGS} -I%s/include")`, dep.Homebrew))
+				cmake.WriteLine(fmt.Sprintf(`  set(CMAKE_EXE_LINKER_FLAGS "${CMAKE_EXE_LINKER_FLAGS} -L%s/lib")`, dep.Homebrew))
+				cmake.WriteLine(fmt.Sprintf(`  set(CMAKE_SHARED_LINKER_FLAGS "${CMAKE_SHARED_LINKER_FLAGS} -L%s/lib")`, dep.Homebrew))
 			})
 			cmake.WriteLine("endif()")
 		}, nil)
-		cmake.RequireHeaderExists("openssl/rsa.h")
-		cmake.RequireLibraryExists("crypto", "RSA_new")
-		cmake.AddRequiredLibrary("crypto")
-		cmake.RequireHeaderExists("openssl/ssl.h")
-		cmake.RequireLibraryExists("ssl", "SSL_read")
-		cmake.AddRequiredLibrary("ssl")
-	},
+	}
+	probe := func() {
+		for _, header := range dep.Headers {
+			cmake.RequireHeaderExists(header)
+		}
+		for _, lib := range dep.Libraries {
+			cmake.RequireLibraryExists(lib.Name, lib.Func)
+			cmake.AddRequiredLibrary(lib.Name)
+		}
+	}
+	pkgConfig := probe
+	if len(dep.PkgConfig) > 0 {
+		pkgConfig = func() {
+			cmake.IfPkgConfigModules(dep.PkgConfig, probe)
+		}
+	}
+	if dep.FindPackage == nil {
+		pkgConfig()
+		return
+	}
+	cmake.IfFindPackage(dep.FindPackage.Name, dep.FindPackage.Targets, pkgConfig)
 }
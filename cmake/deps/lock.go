@@ -0,0 +1,121 @@
+package deps
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LockFilename is the name of the lock file, which lives next to
+// MKBuild.yaml and records the resolved dependencies.
+const LockFilename = "MKBuild.lock"
+
+// Locked is a resolved dependency recorded in the lock file
+type Locked struct {
+	// ID is the dependency ID
+	ID string `yaml:"id"`
+
+	// Version is the resolved version, if any
+	Version string `yaml:"version,omitempty"`
+
+	// URL is the URL from which we download the dependency, if any
+	URL string `yaml:"url,omitempty"`
+
+	// SHA256 is the SHA256 of the file at URL, if any
+	SHA256 string `yaml:"sha256,omitempty"`
+
+	// FallbackURLs are tried in order when URL does not work
+	FallbackURLs []string `yaml:"fallback_urls,omitempty"`
+
+	// Registry is the revision of the registry that resolved the dependency
+	Registry string `yaml:"registry,omitempty"`
+}
+
+// Lock contains the resolved dependencies
+type Lock struct {
+	// Version is the version of the lock file format
+	Version int `yaml:"version"`
+
+	// Dependencies contains the resolved dependencies
+	Dependencies []Locked `yaml:"dependencies"`
+}
+
+// lockHeader is written at the beginning of the lock file.
+const lockHeader = `# Autogenerated by 'mkbuild'; DO NOT EDIT!
+#
+# Run 'mkbuild generate -update' to update the locked dependencies.
+
+`
+
+// ReadLock reads the lock file at |path|. It returns a nil lock and
+// no error if the file does not exist or is empty (e.g. only contains
+// blank lines or comments).
+func ReadLock(path string) (*Lock, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	lock := &Lock{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(lock); err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	if lock.Version != SchemaVersion {
+		return nil, fmt.Errorf("%s: unsupported lock version: %d", path, lock.Version)
+	}
+	return lock, nil
+}
+
+// NewLock creates the lock recording |resolved|.
+func NewLock(resolved []*Resolved) *Lock {
+	lock := &Lock{Version: SchemaVersion}
+	for _, r := range resolved {
+		lock.Dependencies = append(lock.Dependencies, Locked{
+			ID:           r.ID,
+			Version:      r.Version,
+			URL:          r.URL,
+			SHA256:       r.SHA256,
+			FallbackURLs: r.FallbackURLs,
+			Registry:     r.Revision,
+		})
+	}
+	return lock
+}
+
+// Find returns the locked dependency with |id| or nil.
+func (lock *Lock) Find(id string) *Locked {
+	if lock == nil {
+		return nil
+	}
+	for idx := range lock.Dependencies {
+		if lock.Dependencies[idx].ID == id {
+			return &lock.Dependencies[idx]
+		}
+	}
+	return nil
+}
+
+// WriteTo writes the lock file content to |w|.
+func (lock *Lock) WriteTo(w io.Writer) (int64, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString(lockHeader)
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(lock); err != nil {
+		return 0, err
+	}
+	if err := encoder.Close(); err != nil {
+		return 0, err
+	}
+	return buffer.WriteTo(w)
+}
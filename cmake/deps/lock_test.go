@@ -0,0 +1,120 @@
+package deps
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeLock writes |data| into a lock file inside a temporary directory
+// and returns its path. The caller must remove the directory.
+func writeLock(t *testing.T, data string) (string, string) {
+	dir, err := ioutil.TempDir("", "mkbuild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, LockFilename)
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return dir, path
+}
+
+func TestLockRoundTrip(t *testing.T) {
+	registry := mustParseRegistry(t)
+	resolved, err := registry.ResolveAll(refs(t, "example.com/app"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock := NewLock(resolved)
+	var buffer bytes.Buffer
+	if _, err := lock.WriteTo(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buffer.String(), lockHeader) {
+		t.Fatal("missing lock header")
+	}
+	dir, path := writeLock(t, buffer.String())
+	defer os.RemoveAll(dir)
+	read, err := ReadLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, lock) {
+		t.Fatalf("expected %+v, got %+v", lock, read)
+	}
+	// Resolving again using the lock must give the same result
+	again, err := registry.ResolveAll(refs(t, "example.com/app"), read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(NewLock(again), lock) {
+		t.Fatalf("expected %+v, got %+v", lock, NewLock(again))
+	}
+}
+
+func TestLockFind(t *testing.T) {
+	lock := &Lock{Version: SchemaVersion, Dependencies: []Locked{
+		{ID: "example.com/a", Version: "v1"},
+		{ID: "example.com/b"},
+	}}
+	if locked := lock.Find("example.com/a"); locked == nil || locked.Version != "v1" {
+		t.Fatalf("expected example.com/a, got %+v", locked)
+	}
+	if locked := lock.Find("example.com/c"); locked != nil {
+		t.Fatalf("expected nil, got %+v", locked)
+	}
+	var missing *Lock
+	if locked := missing.Find("example.com/a"); locked != nil {
+		t.Fatalf("expected nil, got %+v", locked)
+	}
+}
+
+func TestReadLock(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		data  string
+		empty bool
+		want  string
+	}{
+		{name: "empty", data: "", empty: true},
+		{name: "blank", data: "\n  \n", empty: true},
+		{name: "only comments", data: lockHeader, empty: true},
+		{name: "valid", data: "version: 1\ndependencies:\n- id: example.com/a\n"},
+		{name: "unsupported version", data: "version: 2\n",
+			want: "unsupported lock version: 2"},
+		{name: "unknown field", data: "version: 1\nfoo: bar\n",
+			want: "field foo not found"},
+		{name: "invalid YAML", data: "version: [\n", want: LockFilename},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, path := writeLock(t, tc.data)
+			defer os.RemoveAll(dir)
+			lock, err := ReadLock(path)
+			if tc.want != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.want) {
+					t.Fatalf("expected an error containing %q, got %v", tc.want, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (lock == nil) != tc.empty {
+				t.Fatalf("unexpected lock: %+v", lock)
+			}
+		})
+	}
+}
+
+func TestReadLockMissing(t *testing.T) {
+	lock, err := ReadLock(filepath.Join("nonexistent", LockFilename))
+	if lock != nil || err != nil {
+		t.Fatalf("expected nil and nil, got %+v and %v", lock, err)
+	}
+}
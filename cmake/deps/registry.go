@@ -0,0 +1,158 @@
+package deps
+
+// defaultRegistry is the registry embedded into mkbuild. To add or update a
+// dependency without a new mkbuild release, write a registry file using the
+// same format and reference it from MKBuild.yaml or MKBUILD_REGISTRY.
+var defaultRegistry = `version: 1
+
+revision: "20200115"
+
+dependencies:
+  github.com/adishavit/argh:
+    kind: single-header
+    versions:
+    - version: v1.3.1
+      url: https://raw.githubusercontent.com/adishavit/argh/v1.3.1/argh.h
+      sha256: ddb7dfc18dcf90149735b76fb2cff101067453a1df1943a6911233cb7085980c
+    url_template: https://raw.githubusercontent.com/adishavit/argh/{{.Version}}/argh.h
+
+  github.com/c-ares/c-ares:
+    # TODO(bassosimone): implement c-ares support for Windows
+    kind: system-library
+    warning: not supported on Windows
+    pkg_config: [libcares]
+    version_probe: {header: ares_version.h, macro: ARES_VERSION_STR}
+    headers: [ares.h]
+    libraries:
+    - {name: cares, func: ares_process}
+
+  github.com/catchorg/catch2:
+    kind: single-header
+    versions:
+    - version: v2.11.1
+      url: https://github.com/catchorg/Catch2/releases/download/v2.11.1/catch.hpp
+      sha256: 914690be7714fed1f228679a0e379b4e1f6d7d66f88ac20335b7853ff1a8bc55
+    url_template: https://github.com/catchorg/Catch2/releases/download/{{.Version}}/catch.hpp
+
+  github.com/curl/curl:
+    # TODO(bassosimone): implement curl support for Windows
+    kind: system-library
+    find_package: {name: CURL, targets: ["CURL::libcurl"]}
+    pkg_config: [libcurl]
+    version_probe: {header: curl/curl.h, macro: LIBCURL_VERSION}
+    headers: [curl/curl.h]
+    libraries:
+    - {name: curl, func: curl_easy_init}
+
+  github.com/howardhinnant/date:
+    kind: single-header
+    versions:
+    - version: v2.4.1
+      url: https://raw.githubusercontent.com/HowardHinnant/date/v2.4.1/include/date/date.h
+      sha256: 07aa75752540023ccccab178ed193f536c9d032cbbda997159af9f339d331eda
+    url_template: https://raw.githubusercontent.com/HowardHinnant/date/{{.Version}}/include/date/date.h
+
+  github.com/maxmind/libmaxminddb:
+    # TODO(bassosimone): implement libmaxminddb support for Windows
+    kind: system-library
+    pkg_config: [libmaxminddb]
+    headers: [maxminddb.h]
+    libraries:
+    - {name: maxminddb, func: MMDB_open}
+
+  github.com/measurement-kit/generic-assets:
+    kind: archive
+    versions:
+    - version: "20190520205742"
+      url: https://github.com/measurement-kit/generic-assets/releases/download/20190520205742/generic-assets-20190520205742.tar.gz
+      sha256: 70d590c20b2ed31fd43cc63709b267672fecfeac7e908d11e845664ddd43b04f
+    url_template: https://github.com/measurement-kit/generic-assets/releases/download/{{.Version}}/generic-assets-{{.Version}}.tar.gz
+
+  github.com/measurement-kit/mkbouncer:
+    kind: single-header
+    versions:
+    - version: v0.3.0
+      url: https://raw.githubusercontent.com/measurement-kit/mkbouncer/v0.3.0/mkbouncer.hpp
+      sha256: 7c0a810d58fdbc1ffdacb0eed442d31ebff819e49d1222b81619fe3c582a028c
+    url_template: https://raw.githubusercontent.com/measurement-kit/mkbouncer/{{.Version}}/mkbouncer.hpp
+
+  github.com/measurement-kit/mkcollector:
+    kind: single-header
+    dependencies: [github.com/measurement-kit/mkcurl]
+    versions:
+    - version: v0.6.0
+      url: https://raw.githubusercontent.com/measurement-kit/mkcollector/v0.6.0/mkcollector.hpp
+      sha256: 9c81a0c4212eb411be380d2d4b0bd3ada1d70b23f6039b17fe82d3d4ccad1774
+    url_template: https://raw.githubusercontent.com/measurement-kit/mkcollector/{{.Version}}/mkcollector.hpp
+
+  github.com/measurement-kit/mkcurl:
+    kind: single-header
+    dependencies:
+    - github.com/curl/curl: ">=7.58"
+    versions:
+    - version: v0.12.0
+      url: https://raw.githubusercontent.com/measurement-kit/mkcurl/v0.12.0/mkcurl.hpp
+      sha256: cb58b85ccdf8d9f3b559ccab7d2f31cad4f8aba774e9953534e32373d415ec94
+    url_template: https://raw.githubusercontent.com/measurement-kit/mkcurl/{{.Version}}/mkcurl.hpp
+
+  github.com/measurement-kit/mkdata:
+    kind: single-header
+    versions:
+    - version: v0.3.0
+      url: https://raw.githubusercontent.com/measurement-kit/mkdata/v0.3.0/mkdata.hpp
+      sha256: 96bb0384ecd7231a861111d8818a560b7d5ca83316cf7946a4f1a352db6ecfe3
+    url_template: https://raw.githubusercontent.com/measurement-kit/mkdata/{{.Version}}/mkdata.hpp
+
+  github.com/measurement-kit/mkiplookup:
+    kind: single-header
+    versions:
+    - version: v0.2.0
+      url: https://raw.githubusercontent.com/measurement-kit/mkiplookup/v0.2.0/mkiplookup.hpp
+      sha256: a815119250d09be5eff332289f90fd872910f3dc9f29bb4a5fe60e272b38174f
+    url_template: https://raw.githubusercontent.com/measurement-kit/mkiplookup/{{.Version}}/mkiplookup.hpp
+
+  github.com/measurement-kit/mkmmdb:
+    kind: single-header
+    dependencies: [github.com/maxmind/libmaxminddb]
+    versions:
+    - version: v0.4.0
+      url: https://raw.githubusercontent.com/measurement-kit/mkmmdb/v0.4.0/mkmmdb.hpp
+      sha256: c1cdcf2980c977a0d4abbdd447ddc19eefdfe6faa42b3be752d50f29930d4a87
+    url_template: https://raw.githubusercontent.com/measurement-kit/mkmmdb/{{.Version}}/mkmmdb.hpp
+
+  github.com/measurement-kit/mkmock:
+    kind: single-header
+    versions:
+    - version: v0.2.0
+      url: https://raw.githubusercontent.com/measurement-kit/mkmock/v0.2.0/mkmock.hpp
+      sha256: f07bc063a2e64484482f986501003e45ead653ea3f53fadbdb45c17a51d916d2
+    url_template: https://raw.githubusercontent.com/measurement-kit/mkmock/{{.Version}}/mkmock.hpp
+
+  github.com/measurement-kit/mkuuid4:
+    kind: single-header
+    versions:
+    - version: v0.1.0
+      url: https://raw.githubusercontent.com/measurement-kit/mkuuid4/v0.1.0/mkuuid4.hpp
+      sha256: 5b6b4445697d9beb6ad5310d98b7743c2ffe8266cdec79df0a7a429dcfc247ac
+    url_template: https://raw.githubusercontent.com/measurement-kit/mkuuid4/{{.Version}}/mkuuid4.hpp
+
+  github.com/nlohmann/json:
+    kind: single-header
+    versions:
+    - version: v3.7.3
+      url: https://raw.githubusercontent.com/nlohmann/json/v3.7.3/single_include/nlohmann/json.hpp
+      sha256: 3b5d2b8f8282b80557091514d8ab97e27f9574336c804ee666fda673a9b59926
+    url_template: https://raw.githubusercontent.com/nlohmann/json/{{.Version}}/single_include/nlohmann/json.hpp
+
+  github.com/openssl/openssl:
+    # TODO(bassosimone): implement openssl support for Windows
+    kind: system-library
+    homebrew: /usr/local/opt/openssl@1.1
+    find_package: {name: OpenSSL, targets: ["OpenSSL::SSL", "OpenSSL::Crypto"]}
+    pkg_config: [libcrypto, libssl]
+    version_probe: {header: openssl/opensslv.h, macro: OPENSSL_VERSION_TEXT}
+    headers: [openssl/rsa.h, openssl/ssl.h]
+    libraries:
+    - {name: crypto, func: RSA_new}
+    - {name: ssl, func: SSL_read}
+`
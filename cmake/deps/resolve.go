@@ -0,0 +1,177 @@
+package deps
+
+import (
+	"fmt"
+	"strings"
+)
+
+// request is a request for a specific dependency.
+type request struct {
+	// version is the requested version or empty for the latest
+	version string
+
+	// by is who requested the dependency
+	by string
+
+	// constraints are the requested version constraints
+	constraints []Constraint
+}
+
+// ResolveAll resolves |refs| along with all their dependencies, and
+// returns the result in topological order, i.e., a dependency always
+// comes before the dependencies that need it. Each dependency occurs
+// just once. It is an error if the dependencies form a cycle or if
+// two distinct versions of the same dependency are requested. All the
+// version constraints requested for a dependency must hold.
+//
+// When |lock| is not nil, a versioned dependency that is in |lock| keeps
+// the locked version, URL, and SHA256, unless another version has been
+// explicitly requested.
+func (registry *Registry) ResolveAll(refs Refs, lock *Lock) ([]*Resolved, error) {
+	// Collect all the requests for each dependency.
+	type queued struct {
+		ref Ref
+		by  string
+	}
+	requests := make(map[string][]request)
+	var ids []string // in the order in which we first see them
+	var queue []queued
+	for _, ref := range refs {
+		queue = append(queue, queued{ref: ref, by: "MKBuild.yaml"})
+	}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		id := current.ref.ID
+		dep, found := registry.Dependencies[id]
+		if !found || dep == nil {
+			return nil, fmt.Errorf("unknown dependency: %s (required by %s)",
+				id, current.by)
+		}
+		_, seen := requests[id]
+		if !seen {
+			ids = append(ids, id)
+		}
+		requests[id] = append(requests[id], request{
+			version:     current.ref.Version,
+			by:          current.by,
+			constraints: current.ref.Constraints,
+		})
+		if seen {
+			continue
+		}
+		for _, ref := range dep.Dependencies {
+			queue = append(queue, queued{ref: ref, by: id})
+		}
+	}
+	// Select the version of each dependency.
+	resolved := make(map[string]*Resolved)
+	for _, id := range ids {
+		reqs := requests[id]
+		var selected *request
+		var constraints []Constraint
+		var constrainedBy []string
+		for idx := range reqs {
+			req := &reqs[idx]
+			if len(req.constraints) > 0 {
+				constraints = append(constraints, req.constraints...)
+				constrainedBy = append(constrainedBy, req.by)
+			}
+			if req.version == "" {
+				continue
+			}
+			if selected != nil && selected.version != req.version {
+				return nil, fmt.Errorf(
+					"%s: version conflict: %s requires %s but %s requires %s",
+					id, selected.by, selected.version, req.by, req.version)
+			}
+			selected = req
+		}
+		locked := lock.Find(id)
+		dep := registry.Dependencies[id]
+		if locked != nil && locked.Version != "" && len(dep.Versions) > 0 &&
+			(selected == nil || selected.version == locked.Version) &&
+			Satisfies(locked.Version, constraints) {
+			resolved[id] = &Resolved{
+				ID:           id,
+				Version:      locked.Version,
+				URL:          locked.URL,
+				SHA256:       locked.SHA256,
+				FallbackURLs: locked.FallbackURLs,
+				Dependency:   dep,
+				Revision:     locked.Registry,
+			}
+			continue
+		}
+		var version string
+		var by []string
+		if selected != nil {
+			version = selected.version
+			by = append(by, selected.by)
+		}
+		r, err := registry.resolve(id, version, constraints)
+		if err != nil {
+			if by = append(by, constrainedBy...); len(by) > 0 {
+				return nil, fmt.Errorf("%s (required by %s)",
+					err.Error(), strings.Join(uniqueStrings(by), ", "))
+			}
+			return nil, err
+		}
+		resolved[id] = r
+	}
+	// Sort in topological order using a depth first visit.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var stack []string
+	var result []*Resolved
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch state[id] {
+		case visited:
+			return nil
+		case visiting:
+			var cycle []string
+			for idx := len(stack) - 1; idx >= 0; idx-- {
+				if stack[idx] == id {
+					cycle = append(append(cycle, stack[idx:]...), id)
+					break
+				}
+			}
+			return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+		}
+		state[id] = visiting
+		stack = append(stack, id)
+		for _, ref := range resolved[id].Dependency.Dependencies {
+			if err := visit(ref.ID); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = visited
+		result = append(result, resolved[id])
+		return nil
+	}
+	for _, ref := range refs {
+		if err := visit(ref.ID); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// uniqueStrings returns |s| without duplicates, preserving the order.
+func uniqueStrings(s []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, e := range s {
+		if !seen[e] {
+			seen[e] = true
+			out = append(out, e)
+		}
+	}
+	return out
+}
@@ -0,0 +1,255 @@
+package deps
+
+import (
+	"strings"
+	"testing"
+)
+
+// testRegistry is a registry where example.com/app needs example.com/net
+// and example.com/json, and example.com/net needs example.com/json and
+// example.com/ssl, so that example.com/json is a diamond dependency.
+const testRegistry = `version: 1
+revision: "1"
+dependencies:
+  example.com/app:
+    kind: single-header
+    url: https://example.com/app.hpp
+    sha256: aa
+    dependencies:
+    - example.com/net
+    - example.com/json
+  example.com/net:
+    kind: single-header
+    url: https://example.com/net.hpp
+    sha256: bb
+    dependencies:
+    - example.com/json: ">=1.1"
+    - example.com/ssl: ">=1.0"
+  example.com/json:
+    kind: single-header
+    versions:
+    - {version: v1.0.0, url: https://example.com/1.0.0/json.hpp, sha256: "10"}
+    - {version: v1.1.0, url: https://example.com/1.1.0/json.hpp, sha256: "11"}
+    - {version: v1.2.0, url: https://example.com/1.2.0/json.hpp, sha256: "12"}
+    - {version: v2.0.0, url: https://example.com/2.0.0/json.hpp, sha256: "20"}
+  example.com/ssl:
+    kind: system-library
+    pkg_config: [libssl]
+  example.com/plain:
+    kind: system-library
+    headers: [plain.h]
+  example.com/cycle-a:
+    kind: single-header
+    url: https://example.com/a.hpp
+    sha256: cc
+    dependencies: [example.com/cycle-b]
+  example.com/cycle-b:
+    kind: single-header
+    url: https://example.com/b.hpp
+    sha256: dd
+    dependencies: [example.com/cycle-a]
+`
+
+// mustParseRegistry parses testRegistry.
+func mustParseRegistry(t *testing.T) *Registry {
+	registry, err := Parse("test.yaml", []byte(testRegistry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+// refs builds Refs from references with optional constraints after a
+// space (e.g. "example.com/json >=1.1,<2").
+func refs(t *testing.T, specs ...string) Refs {
+	var result Refs
+	for _, e := range specs {
+		s, constraints := e, ""
+		if idx := strings.Index(e, " "); idx >= 0 {
+			s, constraints = e[:idx], e[idx+1:]
+		}
+		ref := ParseRef(s)
+		if constraints != "" {
+			var err error
+			if ref.Constraints, err = ParseConstraints(constraints); err != nil {
+				t.Fatal(err)
+			}
+		}
+		result = append(result, ref)
+	}
+	return result
+}
+
+func TestResolveAll(t *testing.T) {
+	registry := mustParseRegistry(t)
+	for _, tc := range []struct {
+		name string
+		refs []string
+		lock *Lock
+		want []string
+	}{{
+		name: "latest version",
+		refs: []string{"example.com/json"},
+		want: []string{"example.com/json@v2.0.0"},
+	}, {
+		name: "explicit version",
+		refs: []string{"example.com/json@v1.0.0"},
+		want: []string{"example.com/json@v1.0.0"},
+	}, {
+		name: "constraints",
+		refs: []string{"example.com/json >=1.0,<2"},
+		want: []string{"example.com/json@v1.2.0"},
+	}, {
+		name: "transitive dependencies in topological order",
+		refs: []string{"example.com/app"},
+		want: []string{
+			"example.com/json@v2.0.0",
+			"example.com/ssl",
+			"example.com/net",
+			"example.com/app",
+		},
+	}, {
+		name: "each dependency occurs once",
+		refs: []string{"example.com/json", "example.com/app", "example.com/net"},
+		want: []string{
+			"example.com/json@v2.0.0",
+			"example.com/ssl",
+			"example.com/net",
+			"example.com/app",
+		},
+	}, {
+		name: "constraints from all the requesters",
+		refs: []string{"example.com/app", "example.com/json <2"},
+		want: []string{
+			"example.com/json@v1.2.0",
+			"example.com/ssl",
+			"example.com/net",
+			"example.com/app",
+		},
+	}, {
+		name: "locked version",
+		refs: []string{"example.com/json"},
+		lock: &Lock{Version: SchemaVersion, Dependencies: []Locked{{
+			ID: "example.com/json", Version: "v1.1.0",
+			URL: "https://mirror.example.com/json.hpp", SHA256: "11",
+		}}},
+		want: []string{"example.com/json@v1.1.0"},
+	}, {
+		name: "locked version not satisfying the constraints",
+		refs: []string{"example.com/json >=1.2"},
+		lock: &Lock{Version: SchemaVersion, Dependencies: []Locked{{
+			ID: "example.com/json", Version: "v1.1.0", SHA256: "11",
+		}}},
+		want: []string{"example.com/json@v2.0.0"},
+	}, {
+		name: "explicit version overriding the lock",
+		refs: []string{"example.com/json@v1.0.0"},
+		lock: &Lock{Version: SchemaVersion, Dependencies: []Locked{{
+			ID: "example.com/json", Version: "v1.1.0", SHA256: "11",
+		}}},
+		want: []string{"example.com/json@v1.0.0"},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			resolved, err := registry.ResolveAll(refs(t, tc.refs...), tc.lock)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range resolved {
+				got = append(got, r.Ref())
+			}
+			if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestResolveAllLockedURL(t *testing.T) {
+	registry := mustParseRegistry(t)
+	lock := &Lock{Version: SchemaVersion, Dependencies: []Locked{{
+		ID: "example.com/json", Version: "v1.1.0", SHA256: "11",
+		URL: "https://mirror.example.com/json.hpp", Registry: "0",
+	}}}
+	resolved, err := registry.ResolveAll(refs(t, "example.com/json"), lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := resolved[0]; r.URL != lock.Dependencies[0].URL || r.Revision != "0" {
+		t.Fatalf("expected the locked URL and revision, got %+v", r)
+	}
+}
+
+func TestResolveAllConstraintsOfSystemLibraries(t *testing.T) {
+	registry := mustParseRegistry(t)
+	resolved, err := registry.ResolveAll(refs(t, "example.com/net"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range resolved {
+		if r.ID == "example.com/ssl" {
+			if JoinConstraints(r.Constraints) != ">=1.0" {
+				t.Fatalf("expected >=1.0, got %v", r.Constraints)
+			}
+			return
+		}
+	}
+	t.Fatal("example.com/ssl not resolved")
+}
+
+func TestResolveAllErrors(t *testing.T) {
+	registry := mustParseRegistry(t)
+	for _, tc := range []struct {
+		name string
+		refs []string
+		want string
+	}{{
+		name: "unknown dependency",
+		refs: []string{"example.com/missing"},
+		want: "unknown dependency: example.com/missing (required by MKBuild.yaml)",
+	}, {
+		name: "unknown version",
+		refs: []string{"example.com/json@v3.0.0"},
+		want: "example.com/json: unknown version v3.0.0 (known versions: v1.0.0, v1.1.0, v1.2.0, v2.0.0)",
+	}, {
+		name: "version conflict",
+		refs: []string{"example.com/json@v1.0.0", "example.com/json@v1.1.0"},
+		want: "example.com/json: version conflict: MKBuild.yaml requires v1.0.0 but MKBuild.yaml requires v1.1.0",
+	}, {
+		name: "explicit version not satisfying transitive constraints",
+		refs: []string{"example.com/app", "example.com/json@v1.0.0"},
+		want: "example.com/json: version v1.0.0 does not satisfy >=1.1 (required by MKBuild.yaml, example.com/net)",
+	}, {
+		name: "unsatisfiable constraints",
+		refs: []string{"example.com/json >2", "example.com/json <1"},
+		want: "example.com/json: no known version satisfies >2,<1",
+	}, {
+		name: "constraints of unversioned downloads",
+		refs: []string{"example.com/app >=1"},
+		want: "example.com/app: cannot check version constraints: no known versions",
+	}, {
+		name: "constraints of system libraries without probes",
+		refs: []string{"example.com/plain >=1"},
+		want: "cannot check version constraints without pkg_config or version_probe",
+	}, {
+		name: "cycle",
+		refs: []string{"example.com/cycle-a"},
+		want: "dependency cycle: example.com/cycle-a -> example.com/cycle-b -> example.com/cycle-a",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := registry.ResolveAll(refs(t, tc.refs...), nil)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected an error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestDefaultRegistryResolves(t *testing.T) {
+	registry := Default()
+	for _, id := range registry.IDs() {
+		if _, err := registry.ResolveAll(Refs{{ID: id}}, nil); err != nil {
+			t.Errorf("%s: %s", id, err.Error())
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package deps
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// DefaultAPIURL is the default base URL of the GitHub API.
+const DefaultAPIURL = "https://api.github.com"
+
+// releaseTagRe matches the tags that look like release versions.
+var releaseTagRe = regexp.MustCompile(`^v?[0-9]+(\.[0-9]+)*$`)
+
+// Updater finds and fetches new versions of dependencies
+type Updater struct {
+	// APIURL is the base URL of the GitHub API used to list the tags
+	APIURL string
+
+	// Client is the HTTP client to use
+	Client *http.Client
+}
+
+// Update is a new version of a dependency
+type Update struct {
+	// ID is the dependency ID
+	ID string
+
+	// Current is the current version
+	Current string
+
+	// Pin contains the new version. The SHA256 is only
+	// filled after calling Updater.Fetch.
+	Pin Pin
+}
+
+// repository returns the GitHub "owner/repo" of |id| or an error.
+func repository(id string) (string, error) {
+	parts := strings.Split(id, "/")
+	if len(parts) != 3 || parts[0] != "github.com" {
+		return "", fmt.Errorf("%s: not a github.com/<owner>/<repo> dependency", id)
+	}
+	return parts[1] + "/" + parts[2], nil
+}
+
+// get performs a GET of |URL| and returns the response body.
+func (updater *Updater) get(URL string) (io.ReadCloser, error) {
+	resp, err := updater.Client.Get(URL)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", URL, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// latestTag returns the most recent release tag of |id|.
+func (updater *Updater) latestTag(id string) (string, error) {
+	repo, err := repository(id)
+	if err != nil {
+		return "", err
+	}
+	body, err := updater.get(fmt.Sprintf(
+		"%s/repos/%s/tags?per_page=100",
+		strings.TrimSuffix(updater.APIURL, "/"), repo,
+	))
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	var tags []struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(body).Decode(&tags); err != nil {
+		return "", fmt.Errorf("%s: cannot parse tags: %s", id, err.Error())
+	}
+	var latest string
+	for _, tag := range tags {
+		if !releaseTagRe.MatchString(tag.Name) {
+			continue
+		}
+		if latest == "" || CompareVersions(tag.Name, latest) > 0 {
+			latest = tag.Name
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("%s: no release tags", id)
+	}
+	return latest, nil
+}
+
+// Check checks whether there is a version of |dep|, whose ID is |id|,
+// newer than |current|. It returns a nil update when |current| is
+// already the latest version.
+func (updater *Updater) Check(id string, dep *Dependency, current string) (*Update, error) {
+	if dep.URLTemplate == "" {
+		return nil, fmt.Errorf("%s: missing url_template", id)
+	}
+	tmpl, err := template.New(id).Parse(dep.URLTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid url_template: %s", id, err.Error())
+	}
+	latest, err := updater.latestTag(id)
+	if err != nil {
+		return nil, err
+	}
+	if current != "" && CompareVersions(latest, current) <= 0 {
+		return nil, nil
+	}
+	var URL strings.Builder
+	err = tmpl.Execute(&URL, map[string]string{"Version": latest})
+	if err != nil {
+		return nil, fmt.Errorf("%s: cannot expand url_template: %s", id, err.Error())
+	}
+	return &Update{
+		ID:      id,
+		Current: current,
+		Pin:     Pin{Version: latest, URL: URL.String()},
+	}, nil
+}
+
+// Fetch downloads the new version in |update| and sets its SHA256.
+func (updater *Updater) Fetch(update *Update) error {
+	body, err := updater.get(update.Pin.URL)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return fmt.Errorf("%s: cannot download %s: %s", update.ID,
+			update.Pin.URL, err.Error())
+	}
+	update.Pin.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
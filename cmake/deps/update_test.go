@@ -0,0 +1,138 @@
+package deps
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestUpdater returns an Updater using a local server that lists
+// |tags| for github.com/example/lib and serves |body| under /dl/. The
+// caller must close the server.
+func newTestUpdater(tags, body string) (*Updater, *httptest.Server) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/example/lib/tags", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(tags))
+	})
+	mux.HandleFunc("/dl/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	})
+	server := httptest.NewServer(mux)
+	return &Updater{APIURL: server.URL, Client: server.Client()}, server
+}
+
+func TestUpdaterCheck(t *testing.T) {
+	tags := `[
+		{"name": "v1.2.0"},
+		{"name": "v1.10.0"},
+		{"name": "latest"},
+		{"name": "v2.0.0-rc1"},
+		{"name": "v1.9.7"}
+	]`
+	updater, server := newTestUpdater(tags, "")
+	defer server.Close()
+	dep := &Dependency{
+		URLTemplate: server.URL + "/dl/{{.Version}}/lib.hpp",
+	}
+	for _, tc := range []struct {
+		name    string
+		current string
+		want    string
+	}{
+		{"no current version", "", "v1.10.0"},
+		{"older version", "v1.9.7", "v1.10.0"},
+		{"latest version", "v1.10.0", ""},
+		{"newer version", "v1.11", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			update, err := updater.Check("github.com/example/lib", dep, tc.current)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.want == "" {
+				if update != nil {
+					t.Fatalf("expected no update, got %+v", update)
+				}
+				return
+			}
+			if update == nil {
+				t.Fatal("expected an update")
+			}
+			if update.Pin.Version != tc.want {
+				t.Fatalf("expected %s, got %s", tc.want, update.Pin.Version)
+			}
+			wantURL := server.URL + "/dl/" + tc.want + "/lib.hpp"
+			if update.Pin.URL != wantURL {
+				t.Fatalf("expected %s, got %s", wantURL, update.Pin.URL)
+			}
+			if update.Current != tc.current || update.Pin.SHA256 != "" {
+				t.Fatalf("unexpected update: %+v", update)
+			}
+		})
+	}
+}
+
+func TestUpdaterCheckErrors(t *testing.T) {
+	updater, server := newTestUpdater(`[{"name": "nightly"}]`, "")
+	defer server.Close()
+	template := server.URL + "/dl/{{.Version}}/lib.hpp"
+	for _, tc := range []struct {
+		name string
+		id   string
+		dep  *Dependency
+		want string
+	}{
+		{"not on GitHub", "example.com/lib", &Dependency{URLTemplate: template},
+			"not a github.com/<owner>/<repo> dependency"},
+		{"missing url_template", "github.com/example/lib", &Dependency{},
+			"missing url_template"},
+		{"invalid url_template", "github.com/example/lib",
+			&Dependency{URLTemplate: "{{.Version"}, "invalid url_template"},
+		{"non-200 response", "github.com/example/missing",
+			&Dependency{URLTemplate: template}, "404 Not Found"},
+		{"no release tags", "github.com/example/lib",
+			&Dependency{URLTemplate: template}, "no release tags"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := updater.Check(tc.id, tc.dep, "")
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected an error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestUpdaterCheckInvalidJSON(t *testing.T) {
+	updater, server := newTestUpdater(`{"message": "rate limited"}`, "")
+	defer server.Close()
+	dep := &Dependency{URLTemplate: server.URL + "/dl/{{.Version}}/lib.hpp"}
+	_, err := updater.Check("github.com/example/lib", dep, "")
+	if err == nil || !strings.Contains(err.Error(), "cannot parse tags") {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+}
+
+func TestUpdaterFetch(t *testing.T) {
+	body := "#pragma once\n"
+	updater, server := newTestUpdater("[]", body)
+	defer server.Close()
+	update := &Update{
+		ID:  "github.com/example/lib",
+		Pin: Pin{Version: "v1.0.0", URL: server.URL + "/dl/v1.0.0/lib.hpp"},
+	}
+	if err := updater.Fetch(update); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(body))
+	if want := hex.EncodeToString(sum[:]); update.Pin.SHA256 != want {
+		t.Fatalf("expected %s, got %s", want, update.Pin.SHA256)
+	}
+	update.Pin.URL = server.URL + "/missing"
+	if err := updater.Fetch(update); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected a 404 error, got %v", err)
+	}
+}
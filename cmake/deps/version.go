@@ -0,0 +1,43 @@
+package deps
+
+import (
+	"strconv"
+	"strings"
+)
+
+// versionFields splits |version| into its dot separated fields, after
+// removing the optional leading "v".
+func versionFields(version string) []string {
+	return strings.Split(strings.TrimPrefix(version, "v"), ".")
+}
+
+// CompareVersions compares the |a| and |b| versions (e.g. "v3.7.3") and
+// returns -1, 0, or +1 if |a| is respectively older, equal, or newer than
+// |b|. Numeric fields are compared as numbers, other fields as strings,
+// and a version with more fields is newer ("1.0.1" > "1.0").
+func CompareVersions(a, b string) int {
+	af, bf := versionFields(a), versionFields(b)
+	for i := 0; i < len(af) && i < len(bf); i++ {
+		an, aerr := strconv.ParseUint(af[i], 10, 64)
+		bn, berr := strconv.ParseUint(bf[i], 10, 64)
+		switch {
+		case aerr == nil && berr == nil && an < bn:
+			return -1
+		case aerr == nil && berr == nil && an > bn:
+			return 1
+		case aerr == nil && berr == nil:
+			continue
+		case af[i] < bf[i]:
+			return -1
+		case af[i] > bf[i]:
+			return 1
+		}
+	}
+	switch {
+	case len(af) < len(bf):
+		return -1
+	case len(af) > len(bf):
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/measurement-kit/mkbuild/cmake/deps"
+	"github.com/measurement-kit/mkbuild/pkginfo"
+)
+
+// loadRegistry loads the registry used by the package selected by |ctx|
+// or, if there is no such package, the default registry extended using
+// the $MKBUILD_REGISTRY environment variable.
+func (ctx *context) loadRegistry() (*deps.Registry, error) {
+	if _, err := os.Stat(ctx.filename); os.IsNotExist(err) {
+		return deps.Load(os.Getenv(deps.EnvVar))
+	}
+	pkginfo, err := ctx.loadPkgInfo()
+	if err != nil {
+		return nil, err
+	}
+	return pkginfo.Registry, nil
+}
+
+// runDeps implements `mkbuild deps`.
+func runDeps(ctx *context, args []string) error {
+	subcommand := "list"
+	if len(args) > 0 {
+		subcommand, args = args[0], args[1:]
+	}
+	switch subcommand {
+	case "list":
+		return runDepsList(ctx, args)
+	case "update":
+		return runDepsUpdate(ctx, args)
+	default:
+		return fmt.Errorf("deps: unknown subcommand: %s", subcommand)
+	}
+}
+
+// runDepsList implements `mkbuild deps list`.
+func runDepsList(ctx *context, args []string) error {
+	flags := flag.NewFlagSet("deps list", flag.ExitOnError)
+	all := flags.Bool("all", false, "List all the known dependencies")
+	direct := flags.Bool("direct", false, "Only list the dependencies in the config file")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		return fmt.Errorf("deps list: unexpected arguments: %v", flags.Args())
+	}
+	var names []string
+	if *all {
+		registry, err := ctx.loadRegistry()
+		if err != nil {
+			return err
+		}
+		names = registry.IDs()
+	} else {
+		pkginfo, err := ctx.loadPkgInfo()
+		if err != nil {
+			return err
+		}
+		for _, ref := range pkginfo.Dependencies {
+			names = append(names, ref.String())
+		}
+		if !*direct {
+			resolved, err := pkginfo.Resolve()
+			if err != nil {
+				return err
+			}
+			names = nil
+			for _, dep := range resolved {
+				names = append(names, dep.Ref())
+			}
+		}
+	}
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// runDepsUpdate implements `mkbuild deps update`.
+func runDepsUpdate(ctx *context, args []string) error {
+	flags := flag.NewFlagSet("deps update", flag.ExitOnError)
+	all := flags.Bool("all", false, "Check all the known dependencies")
+	apiURL := flags.String("api-url", deps.DefaultAPIURL, "Base `URL` of the GitHub API")
+	dryRun := flags.Bool("n", false, "Only report the dependencies that are out of date")
+	lock := flags.Bool("lock", false, "Update MKBuild.lock rather than the registry file")
+	registryFile := flags.String("registry", "", "Registry `file` to update (default: the project one)")
+	flags.Parse(args)
+	registry, err := ctx.loadRegistry()
+	if err != nil {
+		return err
+	}
+	var pkginfo *pkginfo.PkgInfo
+	_, statErr := os.Stat(ctx.filename)
+	if statErr == nil || *lock || (!*all && flags.NArg() <= 0) {
+		if pkginfo, err = ctx.loadPkgInfo(); err != nil {
+			return err
+		}
+	}
+	ids := flags.Args()
+	if len(ids) <= 0 && *all {
+		ids = registry.IDs()
+	} else if len(ids) <= 0 {
+		resolved, err := pkginfo.Resolve()
+		if err != nil {
+			return err
+		}
+		for _, dep := range resolved {
+			ids = append(ids, dep.ID)
+		}
+	}
+	updater := &deps.Updater{
+		APIURL: *apiURL,
+		Client: &http.Client{Timeout: 60 * time.Second},
+	}
+	var updates []*deps.Update
+	for _, id := range ids {
+		dep, found := registry.Dependencies[id]
+		if !found {
+			return fmt.Errorf("deps update: unknown dependency: %s", id)
+		}
+		if len(dep.Versions) <= 0 {
+			log.Debugf("%s: skipping dependency without versions", id)
+			continue
+		}
+		current := dep.Latest().Version
+		if *lock {
+			if locked := pkginfo.Lock.Find(id); locked != nil && locked.Version != "" {
+				current = locked.Version
+			}
+		}
+		update, err := updater.Check(id, dep, current)
+		if err != nil {
+			return err
+		}
+		if update == nil {
+			log.Debugf("%s: %s is up to date", id, current)
+			continue
+		}
+		fmt.Printf("%s: %s -> %s\n", id, current, update.Pin.Version)
+		updates = append(updates, update)
+	}
+	if *dryRun || len(updates) <= 0 {
+		return nil
+	}
+	for _, update := range updates {
+		log.Infof("Fetching %s", update.Pin.URL)
+		if err := updater.Fetch(update); err != nil {
+			return err
+		}
+	}
+	if *lock {
+		return updateLock(ctx, pkginfo, registry, updates)
+	}
+	if *registryFile == "" && pkginfo != nil {
+		*registryFile = pkginfo.RegistryFile
+		if *registryFile != "" && !filepath.IsAbs(*registryFile) {
+			*registryFile = filepath.Join(filepath.Dir(ctx.filename), *registryFile)
+		}
+	}
+	if *registryFile == "" {
+		*registryFile = os.Getenv(deps.EnvVar)
+	}
+	if *registryFile == "" {
+		return errors.New("deps update: no registry file to update " +
+			"(use -registry, the registry key of MKBuild.yaml, or -lock)")
+	}
+	return updateRegistryFile(*registryFile, registry, updates)
+}
+
+// updateLock writes |updates| into the lock file of |pkginfo|.
+func updateLock(
+	ctx *context, pkginfo *pkginfo.PkgInfo, registry *deps.Registry,
+	updates []*deps.Update,
+) error {
+	if pkginfo.Lock == nil {
+		return fmt.Errorf("deps update: missing %s; run `mkbuild generate` first",
+			ctx.lockFilename())
+	}
+	for _, update := range updates {
+		locked := pkginfo.Lock.Find(update.ID)
+		if locked == nil {
+			log.Warnf("%s: not in %s", update.ID, ctx.lockFilename())
+			continue
+		}
+		locked.Version = update.Pin.Version
+		locked.URL = update.Pin.URL
+		locked.SHA256 = update.Pin.SHA256
+		locked.FallbackURLs = update.Pin.FallbackURLs
+		locked.Registry = registry.Revision
+	}
+	return writeTo(ctx.lockFilename(), pkginfo.Lock)
+}
+
+// updateRegistryFile adds |updates| to the registry file at |path|,
+// copying dependencies from |registry| when they are not in the file.
+func updateRegistryFile(
+	path string, registry *deps.Registry, updates []*deps.Update,
+) error {
+	file := &deps.Registry{Version: deps.SchemaVersion}
+	if _, err := os.Stat(path); err == nil {
+		if file, err = deps.LoadFile(path); err != nil {
+			return err
+		}
+	}
+	if file.Dependencies == nil {
+		file.Dependencies = make(map[string]*deps.Dependency)
+	}
+	for _, update := range updates {
+		dep, found := file.Dependencies[update.ID]
+		if !found {
+			copied := *registry.Dependencies[update.ID]
+			copied.Versions = append([]deps.Pin{}, copied.Versions...)
+			dep = &copied
+			file.Dependencies[update.ID] = dep
+		}
+		dep.Versions = append(dep.Versions, update.Pin)
+	}
+	file.Revision = time.Now().UTC().Format("20060102150405")
+	return writeTo(path, file)
+}
+
+// writeTo writes the content of |w| into |filename|.
+func writeTo(filename string, w io.WriterTo) error {
+	filep, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := w.WriteTo(filep); err != nil {
+		filep.Close()
+		return err
+	}
+	if err := filep.Close(); err != nil {
+		return err
+	}
+	log.Infof("Written %s", filename)
+	return nil
+}
@@ -0,0 +1,159 @@
+// Package diff computes unified diffs between texts
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// context is the number of unchanged lines shown around changes.
+const context = 3
+
+// op is an edit operation on a single line.
+type op struct {
+	// kind is ' ' for unchanged lines, '-' for deletions, '+' for additions
+	kind byte
+
+	// line is the line content without the trailing newline
+	line string
+}
+
+// noNewline is the marker that follows a last line without newline.
+const noNewline = "\n\\ No newline at end of file"
+
+// splitLines splits |s| into lines without the trailing newline. Like
+// diff, we append noNewline to a last line without newline, so that it
+// differs from the same line with newline and we print the marker.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += noNewline
+	return lines
+}
+
+// edits computes the edit script from |a| to |b| using the longest
+// common subsequence of lines.
+func edits(a, b []string) []op {
+	n, m := len(a), len(b)
+	// lcs[i*(m+1)+j] is the length of the LCS of a[i:] and b[j:].
+	lcs := make([]int32, (n+1)*(m+1))
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j+1] + 1
+			} else if lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1] {
+				lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j]
+			} else {
+				lcs[i*(m+1)+j] = lcs[i*(m+1)+j+1]
+			}
+		}
+	}
+	var ops []op
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, op{' ', a[i]})
+			i, j = i+1, j+1
+		case lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1]:
+			ops = append(ops, op{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, op{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, op{'-', a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, op{'+', b[j]})
+	}
+	return ops
+}
+
+// hunkRange formats a range of a hunk header.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start-- // an empty range refers to the line before
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// Unified returns the unified diff transforming |a|, whose name is
+// |aName|, into |b|, whose name is |bName|. It returns the empty string
+// when the two texts are equal.
+func Unified(aName, bName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	ops := edits(splitLines(a), splitLines(b))
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+	// aLine and bLine are the one-based line numbers of ops[idx].
+	aLine, bLine := 1, 1
+	for idx := 0; idx < len(ops); {
+		if ops[idx].kind == ' ' {
+			aLine, bLine, idx = aLine+1, bLine+1, idx+1
+			continue
+		}
+		// Find the end of the hunk, merging changes that are
+		// separated by at most 2*context unchanged lines.
+		start := idx - context
+		if start < 0 {
+			start = 0
+		}
+		end := idx
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				end += context
+				if end > len(ops) {
+					end = len(ops)
+				}
+				break
+			}
+			end = run
+		}
+		aStart, bStart := aLine-(idx-start), bLine-(idx-start)
+		var aCount, bCount int
+		for _, o := range ops[start:end] {
+			if o.kind != '+' {
+				aCount++
+			}
+			if o.kind != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		for _, o := range ops[start:end] {
+			fmt.Fprintf(&out, "%c%s\n", o.kind, o.line)
+		}
+		for _, o := range ops[idx:end] {
+			if o.kind != '+' {
+				aLine++
+			}
+			if o.kind != '-' {
+				bLine++
+			}
+		}
+		idx = end
+	}
+	return out.String()
+}
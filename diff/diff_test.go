@@ -0,0 +1,104 @@
+package diff
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// numbered returns the lines from 1 to |n|, replacing the line numbers
+// in |replace| with the corresponding text.
+func numbered(n int, replace map[int]string) string {
+	var out strings.Builder
+	for i := 1; i <= n; i++ {
+		line, found := replace[i]
+		if !found {
+			line = strconv.Itoa(i)
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.String()
+}
+
+// The expected diffs are the output of `diff -u --label a --label b`.
+func TestUnified(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		a, b string
+		want string
+	}{{
+		name: "equal",
+		a:    numbered(5, nil),
+		b:    numbered(5, nil),
+		want: "",
+	}, {
+		name: "change",
+		a:    numbered(10, nil),
+		b:    numbered(10, map[int]string{5: "x"}),
+		want: "--- a\n+++ b\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+x\n 6\n 7\n 8\n",
+	}, {
+		name: "append",
+		a:    numbered(5, nil),
+		b:    numbered(6, nil),
+		want: "--- a\n+++ b\n@@ -3,3 +3,4 @@\n 3\n 4\n 5\n+6\n",
+	}, {
+		name: "prepend",
+		a:    numbered(5, nil),
+		b:    "0\n" + numbered(5, nil),
+		want: "--- a\n+++ b\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n",
+	}, {
+		name: "delete first line",
+		a:    numbered(5, nil),
+		b:    "2\n3\n4\n5\n",
+		want: "--- a\n+++ b\n@@ -1,4 +1,3 @@\n-1\n 2\n 3\n 4\n",
+	}, {
+		name: "from empty",
+		a:    "",
+		b:    "a\nb\n",
+		want: "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+	}, {
+		name: "to empty",
+		a:    "a\nb\n",
+		b:    "",
+		want: "--- a\n+++ b\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+	}, {
+		name: "distant changes",
+		a:    numbered(20, nil),
+		b:    numbered(20, map[int]string{2: "x", 18: "x"}),
+		want: "--- a\n+++ b\n@@ -1,5 +1,5 @@\n 1\n-2\n+x\n 3\n 4\n 5\n" +
+			"@@ -15,6 +15,6 @@\n 15\n 16\n 17\n-18\n+x\n 19\n 20\n",
+	}, {
+		name: "close changes",
+		a:    numbered(20, nil),
+		b:    numbered(20, map[int]string{5: "x", 11: "x"}),
+		want: "--- a\n+++ b\n@@ -2,13 +2,13 @@\n 2\n 3\n 4\n-5\n+x\n 6\n 7\n 8\n" +
+			" 9\n 10\n-11\n+x\n 12\n 13\n 14\n",
+	}, {
+		name: "missing newline",
+		a:    "1\n2\n3",
+		b:    "1\n2\n3\n",
+		want: "--- a\n+++ b\n@@ -1,3 +1,3 @@\n 1\n 2\n-3\n\\ No newline at end of file\n+3\n",
+	}, {
+		name: "both without newline",
+		a:    "1\n2\n3",
+		b:    "1\n2\nx",
+		want: "--- a\n+++ b\n@@ -1,3 +1,3 @@\n 1\n 2\n-3\n\\ No newline at end of file\n" +
+			"+x\n\\ No newline at end of file\n",
+	}, {
+		name: "context without newline",
+		a:    "1\n2\n3",
+		b:    "x\n2\n3",
+		want: "--- a\n+++ b\n@@ -1,3 +1,3 @@\n-1\n+x\n 2\n 3\n\\ No newline at end of file\n",
+	}, {
+		name: "from empty without newline",
+		a:    "",
+		b:    "1\n2\n3",
+		want: "--- a\n+++ b\n@@ -0,0 +1,3 @@\n+1\n+2\n+3\n\\ No newline at end of file\n",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Unified("a", "b", tc.a, tc.b); got != tc.want {
+				t.Fatalf("expected:\n%s\ngot:\n%s", tc.want, got)
+			}
+		})
+	}
+}
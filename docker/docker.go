@@ -2,7 +2,11 @@
 package docker
 
 import (
-	"os"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
 	"text/template"
 
 	"github.com/apex/log"
@@ -40,6 +44,7 @@ if [ $INTERNAL -eq 0 ]; then
                   --cap-add=SYS_PTRACE \
                   -e CODECOV_TOKEN=$CODECOV_TOKEN \
                   -e TRAVIS_BRANCH=$TRAVIS_BRANCH \
+                  -e MKBUILD_OFFLINE=$MKBUILD_OFFLINE \
                   -v "$(pwd):/mk" \
                   --workdir /mk \
                   -t {{.CONTAINER_NAME}} \
@@ -81,10 +86,20 @@ else
   exit 1
 fi
 
+# Share downloaded dependencies among all the build types
+export MKBUILD_CACHE_DIR="${MKBUILD_CACHE_DIR:-$(pwd)/build/.cache}"
+
+# Only use vendored or cached dependencies when MKBUILD_OFFLINE is set. We
+# always pass the option, because CMake caches it across runs.
+MKBUILD_OFFLINE_FLAG="-DMKBUILD_OFFLINE=OFF"
+if [ "$MKBUILD_OFFLINE" != "" -a "$MKBUILD_OFFLINE" != "0" ]; then
+  MKBUILD_OFFLINE_FLAG="-DMKBUILD_OFFLINE=ON"
+fi
+
 # Configure and make equivalent
 mkdir -p build/$BUILD_TYPE
 cd build/$BUILD_TYPE
-cmake -GNinja -DCMAKE_BUILD_TYPE=$CMAKE_BUILD_TYPE ../../
+cmake -GNinja -DCMAKE_BUILD_TYPE=$CMAKE_BUILD_TYPE $MKBUILD_OFFLINE_FLAG ../../
 cmake --build . -- -v
 
 # Make sure we don't consume too much resources by bumping latency. Not all
@@ -116,31 +131,29 @@ func tcDisabledString(pkginfo *pkginfo.PkgInfo) (s string) {
 	return
 }
 
-// writeSingleDockerScript writes a single docker script.
-func writeSingleDockerScript(
-	pkginfo *pkginfo.PkgInfo, dirname, name, content string,
-) {
-	tmpl := template.Must(template.New(name).Parse(content))
-	filename := dirname + "/" + name
-	filep, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
-	if err != nil {
-		log.WithError(err).Fatalf("cannot open file: %s", filename)
+// Render renders the docker.sh script for |pkginfo| into |w|.
+func Render(pkginfo *pkginfo.PkgInfo, w io.Writer) error {
+	if pkginfo.Docker == "" {
+		return errors.New("no docker container specified")
 	}
-	defer filep.Close()
-	err = tmpl.Execute(filep, map[string]string{
+	tmpl := template.Must(template.New("docker.sh").Parse(dockerSh))
+	return tmpl.Execute(w, map[string]string{
 		"CONTAINER_NAME": pkginfo.Docker,
 		"TC_DISABLED":    tcDisabledString(pkginfo),
 	})
-	if err != nil {
-		log.WithError(err).Fatalf("cannot write file: %s", filename)
-	}
-	log.Infof("Written %s", filename)
 }
 
-// Generate generates all the docker scripts.
-func Generate(pkginfo *pkginfo.PkgInfo) {
-	if pkginfo.Docker == "" {
-		log.Fatal("no docker container specified")
+// Generate writes the docker.sh script in |dir|. We render it in memory
+// first, so that a failure leaves docker.sh intact.
+func Generate(pkginfo *pkginfo.PkgInfo, dir string) error {
+	filename := filepath.Join(dir, "docker.sh")
+	var buffer bytes.Buffer
+	if err := Render(pkginfo, &buffer); err != nil {
+		return err
 	}
-	writeSingleDockerScript(pkginfo, ".", "docker.sh", dockerSh)
+	if err := ioutil.WriteFile(filename, buffer.Bytes(), 0755); err != nil {
+		return err
+	}
+	log.Infof("Written %s", filename)
+	return nil
 }
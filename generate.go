@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/measurement-kit/mkbuild/cmake"
+	"github.com/measurement-kit/mkbuild/docker"
+)
+
+// runGenerate implements `mkbuild generate`.
+func runGenerate(ctx *context, args []string) error {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	only := flags.String("only", "", "Only generate `cmake` or `docker` files")
+	update := flags.Bool("update", false, "Update the dependencies locked in MKBuild.lock")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		return fmt.Errorf("generate: unexpected arguments: %v", flags.Args())
+	}
+	if *only != "" && *only != "cmake" && *only != "docker" {
+		return fmt.Errorf("generate: --only must be cmake or docker, not %s", *only)
+	}
+	pkginfo, err := ctx.loadPkgInfo()
+	if err != nil {
+		return err
+	}
+	if *update {
+		pkginfo.Lock = nil
+	}
+	if *only == "" || *only == "docker" {
+		if err := docker.Generate(pkginfo, ctx.outputDir()); err != nil {
+			return fmt.Errorf("cannot generate docker.sh: %s", err.Error())
+		}
+	}
+	if *only == "" || *only == "cmake" {
+		if err := cmake.Generate(pkginfo, ctx.outputDir()); err != nil {
+			return fmt.Errorf("cannot generate CMakeLists.txt: %s", err.Error())
+		}
+		if err := cmake.GenerateLock(pkginfo, ctx.lockFilename()); err != nil {
+			return fmt.Errorf("cannot generate %s: %s", ctx.lockFilename(), err.Error())
+		}
+	}
+	return nil
+}
@@ -4,5 +4,5 @@ go 1.13
 
 require (
 	github.com/apex/log v1.1.1
-	gopkg.in/yaml.v2 v2.2.7
+	gopkg.in/yaml.v3 v3.0.1
 )
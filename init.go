@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"text/template"
+
+	"github.com/apex/log"
+	"gopkg.in/yaml.v3"
+)
+
+// skeleton is the template of the MKBuild.yaml written by `mkbuild init`.
+var skeleton = `name: {{quote .Name}}
+
+docker: {{quote .Docker}}
+
+dependencies:
+- github.com/catchorg/catch2
+
+targets:
+  libraries:
+    {{quote .Name}}:
+      compile: [{{quote (printf "%s.cpp" .Name)}}]
+  executables:
+    tests:
+      compile: [tests.cpp]
+      link: [{{quote .Name}}]
+
+tests:
+  unit_tests:
+    command: tests
+`
+
+// plainRe matches the strings that may be plain YAML scalars everywhere
+// in the skeleton, including inside flow sequences.
+var plainRe = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_./-]*$`)
+
+// quote returns |s| as a YAML scalar, quoting it unless it is a plain
+// scalar that YAML reads back as the same string (e.g. not "true").
+func quote(s string) string {
+	var value interface{}
+	if plainRe.MatchString(s) && yaml.Unmarshal([]byte(s), &value) == nil &&
+		value == s {
+		return s
+	}
+	data, _ := json.Marshal(s) // a JSON string is a YAML string
+	return string(data)
+}
+
+// runInit implements `mkbuild init`.
+func runInit(ctx *context, args []string) error {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	name := flags.String("name", "", "Name of the project (default: directory name)")
+	container := flags.String("docker", "bassosimone/mk-debian", "Docker container to use")
+	force := flags.Bool("force", false, "Overwrite an existing config file")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		return fmt.Errorf("init: unexpected arguments: %v", flags.Args())
+	}
+	if *name == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		*name = filepath.Base(cwd)
+	}
+	if _, err := os.Stat(ctx.filename); err == nil && !*force {
+		return fmt.Errorf("init: %s already exists (use -force to overwrite)", ctx.filename)
+	}
+	tmpl := template.Must(template.New("skeleton").Funcs(template.FuncMap{
+		"quote": quote,
+	}).Parse(skeleton))
+	filep, err := ioutil.TempFile(filepath.Dir(ctx.filename), ".mkbuild")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(filep.Name())
+	err = tmpl.Execute(filep, map[string]string{
+		"Name":   *name,
+		"Docker": *container,
+	})
+	if err != nil {
+		filep.Close()
+		return err
+	}
+	if err := filep.Close(); err != nil {
+		return err
+	}
+	// TempFile uses 0600, while we want the same mode of other files
+	if err := os.Chmod(filep.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(filep.Name(), ctx.filename); err != nil {
+		return err
+	}
+	log.Infof("Written %s", ctx.filename)
+	return nil
+}
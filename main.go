@@ -1,17 +1,126 @@
+// Command mkbuild generates the build files of a Measurement Kit project
+// according to the instructions contained in MKBuild.yaml.
 package main
 
 import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/cli"
-	"github.com/measurement-kit/mkbuild/cmake"
-	"github.com/measurement-kit/mkbuild/docker"
+	"github.com/measurement-kit/mkbuild/cmake/deps"
 	"github.com/measurement-kit/mkbuild/pkginfo"
 )
 
+// version is the version of mkbuild. It may be overridden at link time
+// using `-ldflags "-X main.version=..."`.
+var version = "0.1.0-dev"
+
+// context contains the settings shared by all subcommands.
+type context struct {
+	// filename is the name of the MKBuild.yaml file to use
+	filename string
+}
+
+// loadPkgInfo loads the package info selected by |ctx|.
+func (ctx *context) loadPkgInfo() (*pkginfo.PkgInfo, error) {
+	pkginfo, err := pkginfo.Load(ctx.filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load %s:\n%s", ctx.filename, err.Error())
+	}
+	return pkginfo, nil
+}
+
+// outputDir returns the directory containing the config file, where we
+// write all the generated files.
+func (ctx *context) outputDir() string {
+	return filepath.Dir(ctx.filename)
+}
+
+// outputFilename returns the name of the generated file |name|.
+func (ctx *context) outputFilename(name string) string {
+	return filepath.Join(ctx.outputDir(), name)
+}
+
+// lockFilename returns the name of the lock file next to the config file.
+func (ctx *context) lockFilename() string {
+	return ctx.outputFilename(deps.LockFilename)
+}
+
+// command is a mkbuild subcommand.
+type command struct {
+	// synopsis briefly describes the command
+	synopsis string
+
+	// run runs the command with the specified command line |args|.
+	run func(ctx *context, args []string) error
+}
+
+// commands contains all the subcommands we know of.
+var commands = map[string]command{
+	"check":    {"Check whether the generated files are up to date", runCheck},
+	"deps":     {"List and manage dependencies", runDeps},
+	"generate": {"Generate CMakeLists.txt, docker.sh and MKBuild.lock", runGenerate},
+	"init":     {"Create a skeleton MKBuild.yaml", runInit},
+	"vendor":   {"Download dependencies into third_party", runVendor},
+	"version":  {"Print the mkbuild version", runVersion},
+}
+
+// defaultCommand is the command run when no command is specified.
+const defaultCommand = "generate"
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: mkbuild [flags] [command] [command flags]\n\n")
+	fmt.Fprintf(os.Stderr, "Commands (default: %s):\n", defaultCommand)
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].synopsis)
+	}
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
 func main() {
 	log.SetHandler(cli.Default)
-	log.SetLevel(log.DebugLevel)
-	pkginfo := pkginfo.Read()
-	docker.Generate(pkginfo)
-	cmake.Generate(pkginfo)
+	ctx := &context{}
+	flag.Usage = usage
+	flag.StringVar(&ctx.filename, "f", "MKBuild.yaml", "Use the specified config file")
+	workdir := flag.String("C", "", "Change to the specified directory first")
+	quiet := flag.Bool("q", false, "Only print warnings and errors")
+	verbose := flag.Bool("v", false, "Also print debug messages")
+	flag.Parse()
+	switch {
+	case *quiet:
+		log.SetLevel(log.WarnLevel)
+	case *verbose:
+		log.SetLevel(log.DebugLevel)
+	default:
+		log.SetLevel(log.InfoLevel)
+	}
+	if *workdir != "" {
+		if err := os.Chdir(*workdir); err != nil {
+			log.WithError(err).Fatalf("cannot change directory to %s", *workdir)
+		}
+	}
+	args := flag.Args()
+	name := defaultCommand
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	cmd, found := commands[name]
+	if !found {
+		fmt.Fprintf(os.Stderr, "mkbuild: unknown command: %s\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(ctx, args); err != nil {
+		log.Fatal(err.Error())
+	}
 }
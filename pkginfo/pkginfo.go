@@ -2,10 +2,14 @@
 package pkginfo
 
 import (
+	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 
-	"github.com/apex/log"
-	"gopkg.in/yaml.v2"
+	"github.com/measurement-kit/mkbuild/cmake/deps"
+	"gopkg.in/yaml.v3"
 )
 
 // BuildInfo contains info on building a target
@@ -16,6 +20,11 @@ type BuildInfo struct {
 	// Link lists all the libraries to link
 	Link []string
 
+	// Dependencies lists the dependencies to link with, which must be
+	// in the package dependencies or optional dependencies. When it is
+	// missing, we link with all the dependencies.
+	Dependencies deps.Refs
+
 	// Install indicates whether to install the target
 	Install bool
 }
@@ -28,11 +37,24 @@ type LibraryBuildInfo struct {
 	// Link lists all the libraries to link
 	Link []string
 
+	// Dependencies lists the dependencies to link with, which must be
+	// in the package dependencies or optional dependencies. When it is
+	// missing, we link with all the dependencies.
+	Dependencies deps.Refs
+
 	// Install indicates whether to install the library
 	Install bool
 
 	// Headers contains all the public headers
 	Headers []string
+
+	// Type is "static", "shared", "object" or "interface". When it is
+	// missing, BUILD_SHARED_LIBS decides between static and shared.
+	Type string
+
+	// SOVersion is the SOVERSION of a shared library. When it is missing,
+	// we use the first component of the package version.
+	SOVersion string `yaml:"soversion"`
 }
 
 // ScriptBuildInfo contains info on building a script
@@ -85,6 +107,20 @@ type PkgInfo struct {
 	// Name is the name of the package
 	Name string
 
+	// Version is the version of the package (e.g. "0.12.0"), which is
+	// also the VERSION of shared libraries
+	Version string
+
+	// Description is a short description of the package
+	Description string
+
+	// HomepageURL is the URL of the package homepage
+	HomepageURL string `yaml:"homepage_url"`
+
+	// License is the SPDX identifier of the package license
+	// (e.g. "BSD-2-Clause")
+	License string
+
 	// FunctionChecks contains all the checks for functions
 	FunctionChecks []FunctionCheck `yaml:"function_checks"`
 
@@ -103,7 +139,39 @@ type PkgInfo struct {
 	DockerTcDisabled bool `yaml:"docker_tc_disabled"`
 
 	// Dependencies are the package dependencies
-	Dependencies []string
+	Dependencies deps.Refs
+
+	// OptionalDependencies are system libraries to use when available.
+	// For each one that we find, we define MK_HAVE_<NAME>.
+	OptionalDependencies deps.Refs `yaml:"optional_dependencies"`
+
+	// RegistryFile is the path of a registry file, relative to the
+	// directory containing MKBuild.yaml, that overrides or extends the
+	// default dependencies registry.
+	RegistryFile string `yaml:"registry"`
+
+	// Mirrors lists URL prefixes (file:// is allowed) from which to try
+	// downloading dependencies before trying their upstream URLs
+	Mirrors []string
+
+	// CustomDependencies maps the ID of project-local dependencies to
+	// their definition, using the same format of the registry. To use a
+	// custom dependency, list its ID in Dependencies.
+	CustomDependencies map[string]*deps.Dependency `yaml:"custom_dependencies"`
+
+	// Registry contains all the known dependencies. Load fills it using,
+	// in order, the default registry, RegistryFile, CustomDependencies,
+	// and the registry file in $MKBUILD_REGISTRY.
+	Registry *deps.Registry `yaml:"-"`
+
+	// Lock contains the dependencies locked by a previous run. Load fills
+	// it using the MKBuild.lock file next to MKBuild.yaml, if any.
+	Lock *deps.Lock `yaml:"-"`
+
+	// CMakeStyle selects how to pass include directories, definitions
+	// and libraries to targets: "global" (the default) uses directory
+	// wide settings, "targets" uses per target usage requirements.
+	CMakeStyle string `yaml:"cmake_style"`
 
 	// Amalgamate maps names the name of an amalgamated file to the
 	// sorted list of source files that should be amalgamated.
@@ -116,17 +184,154 @@ type PkgInfo struct {
 	Tests map[string]TestInfo
 }
 
-// Read reads package info from "MKBuild.yaml"
-func Read() *PkgInfo {
-	filename := "MKBuild.yaml"
+// Load loads package info from the |filename| file, which usually
+// is "MKBuild.yaml". All the problems in the file are reported together
+// using a Diagnostics error.
+func Load(filename string) (*PkgInfo, error) {
 	data, err := ioutil.ReadFile(filename)
 	if err != nil {
-		log.WithError(err).Fatalf("cannot read %s", filename)
+		return nil, err
+	}
+	return parse(filename, data)
+}
+
+// parse strictly parses |data| read from |filename|. Unknown keys and
+// inconsistencies are reported together as Diagnostics.
+func parse(filename string, data []byte) (*PkgInfo, error) {
+	var root yaml.Node
+	var ds Diagnostics
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		ds.addYAMLError(filename, err)
+		return nil, ds
 	}
+	ds.checkKnownFields(filename, &root, reflect.TypeOf(PkgInfo{}))
 	pkginfo := &PkgInfo{}
-	err = yaml.Unmarshal(data, pkginfo)
+	if err := root.Decode(pkginfo); err != nil {
+		ds.addYAMLError(filename, err)
+	} else {
+		var err error
+		if err = pkginfo.loadRegistry(filename); err != nil {
+			node, _ := lookup(&root, "registry")
+			ds.add(filename, node, "cannot load registry: %s", err.Error())
+			pkginfo.Registry = deps.Default()
+		}
+		lockfile := filepath.Join(filepath.Dir(filename), deps.LockFilename)
+		if pkginfo.Lock, err = deps.ReadLock(lockfile); err != nil {
+			ds.add(lockfile, nil, "cannot load lock: %s", err.Error())
+		}
+		ds = append(ds, pkginfo.validate(filename, &root)...)
+	}
+	if len(ds) > 0 {
+		ds.sort()
+		return nil, ds
+	}
+	return pkginfo, nil
+}
+
+// loadRegistry fills pkginfo.Registry. The RegistryFile path is relative
+// to the directory containing |filename|.
+func (pkginfo *PkgInfo) loadRegistry(filename string) error {
+	registryFile := pkginfo.RegistryFile
+	if registryFile != "" && !filepath.IsAbs(registryFile) {
+		registryFile = filepath.Join(filepath.Dir(filename), registryFile)
+	}
+	registry, err := deps.Load(registryFile)
 	if err != nil {
-		log.WithError(err).Fatalf("cannot unmarshal %s", filename)
+		return err
+	}
+	// validate reports the custom dependencies without definition
+	custom := make(map[string]*deps.Dependency)
+	for id, dep := range pkginfo.CustomDependencies {
+		if dep != nil {
+			custom[id] = dep
+		}
+	}
+	registry.Merge(&deps.Registry{Dependencies: custom})
+	if path := os.Getenv(deps.EnvVar); path != "" {
+		other, err := deps.LoadFile(path)
+		if err != nil {
+			return err
+		}
+		registry.Merge(other)
+	}
+	pkginfo.Registry = registry
+	return nil
+}
+
+// Resolve resolves all the dependencies of |pkginfo|, honouring the
+// versions in pkginfo.Lock, if any.
+func (pkginfo *PkgInfo) Resolve() ([]*deps.Resolved, error) {
+	registry := pkginfo.Registry
+	if registry == nil {
+		registry = deps.Default()
+	}
+	return registry.ResolveAll(pkginfo.Dependencies, pkginfo.Lock)
+}
+
+// ResolveOptional resolves the optional dependencies of |pkginfo|, which
+// must be system libraries that are not also required dependencies.
+func (pkginfo *PkgInfo) ResolveOptional() ([]*deps.Resolved, error) {
+	registry := pkginfo.Registry
+	if registry == nil {
+		registry = deps.Default()
+	}
+	required := make(map[string]bool)
+	for _, ref := range pkginfo.Dependencies {
+		required[ref.ID] = true
+	}
+	var result []*deps.Resolved
+	for _, ref := range pkginfo.OptionalDependencies {
+		resolved, err := registry.Resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		if resolved.Dependency.Kind != deps.SystemLibrary {
+			return nil, fmt.Errorf("%s: only a %s can be optional",
+				resolved.ID, deps.SystemLibrary)
+		}
+		if required[resolved.ID] {
+			return nil, fmt.Errorf("%s: both required and optional", resolved.ID)
+		}
+		result = append(result, resolved)
+	}
+	return result, nil
+}
+
+// TargetDependencies returns the IDs of the dependencies of a target that
+// lists |refs| in its dependencies, including the dependencies they need,
+// or nil if |refs| is nil. They must all be dependencies or optional
+// dependencies of |pkginfo|.
+func (pkginfo *PkgInfo) TargetDependencies(refs deps.Refs) ([]string, error) {
+	if refs == nil {
+		return nil, nil
+	}
+	registry := pkginfo.Registry
+	if registry == nil {
+		registry = deps.Default()
+	}
+	resolved, err := registry.ResolveAll(refs, pkginfo.Lock)
+	if err != nil {
+		return nil, err
+	}
+	required, err := pkginfo.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	optional, err := pkginfo.ResolveOptional()
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	for _, dep := range append(required, optional...) {
+		known[dep.ID] = true
+	}
+	ids := []string{}
+	for _, dep := range resolved {
+		if !known[dep.ID] {
+			return nil, fmt.Errorf(
+				"%s: neither in dependencies nor in optional_dependencies", dep.ID)
+		}
+		ids = append(ids, dep.ID)
 	}
-	return pkginfo
+	return ids, nil
 }
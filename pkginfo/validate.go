@@ -0,0 +1,350 @@
+package pkginfo
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/measurement-kit/mkbuild/cmake/deps"
+	"gopkg.in/yaml.v3"
+)
+
+// Diagnostic describes a problem at a specific position of a file
+type Diagnostic struct {
+	// Filename is the name of the file containing the problem
+	Filename string
+
+	// Line is the line where the problem is (one-based)
+	Line int
+
+	// Column is the column where the problem is (one-based)
+	Column int
+
+	// Message describes the problem
+	Message string
+}
+
+// String formats the diagnostic as "file:line:column: message". The
+// column is omitted when it is not known.
+func (d Diagnostic) String() string {
+	if d.Column <= 0 {
+		return fmt.Sprintf("%s:%d: %s", d.Filename, d.Line, d.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", d.Filename, d.Line, d.Column, d.Message)
+}
+
+// Diagnostics is a list of problems found when reading a file. We use
+// it as an error so that all problems are reported together.
+type Diagnostics []Diagnostic
+
+// Error implements error by listing all the diagnostics, one per line
+func (ds Diagnostics) Error() string {
+	var lines []string
+	for _, d := range ds {
+		lines = append(lines, d.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// add adds a diagnostic for |node| to |ds|.
+func (ds *Diagnostics) add(
+	filename string, node *yaml.Node, format string, args ...interface{},
+) {
+	d := Diagnostic{
+		Filename: filename,
+		Line:     1,
+		Column:   1,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	if node != nil && node.Line > 0 {
+		d.Line, d.Column = node.Line, node.Column
+	}
+	*ds = append(*ds, d)
+}
+
+// sort sorts |ds| by position in the file.
+func (ds Diagnostics) sort() {
+	sort.SliceStable(ds, func(i, j int) bool {
+		if ds[i].Line != ds[j].Line {
+			return ds[i].Line < ds[j].Line
+		}
+		return ds[i].Column < ds[j].Column
+	})
+}
+
+// yamlErrorRe matches the "line N: message" errors emitted by yaml.
+var yamlErrorRe = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// addYAMLError adds to |ds| the problems described by the |err| returned
+// by the yaml package, which only tells us about line numbers.
+func (ds *Diagnostics) addYAMLError(filename string, err error) {
+	var messages []string
+	if typeError, ok := err.(*yaml.TypeError); ok {
+		messages = typeError.Errors
+	} else {
+		messages = []string{err.Error()}
+	}
+	for _, message := range messages {
+		d := Diagnostic{Filename: filename, Message: message}
+		if m := yamlErrorRe.FindStringSubmatch(message); m != nil {
+			d.Line, _ = strconv.Atoi(m[1])
+			d.Message = m[2]
+		}
+		*ds = append(*ds, d)
+	}
+}
+
+// unmarshalerType is the type of yaml.Unmarshaler.
+var unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// resolve follows document and alias nodes until it finds a real node.
+func resolve(node *yaml.Node) *yaml.Node {
+	for node != nil {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			if len(node.Content) < 1 {
+				return nil
+			}
+			node = node.Content[0]
+		case yaml.AliasNode:
+			node = node.Alias
+		default:
+			return node
+		}
+	}
+	return nil
+}
+
+// yamlFields maps the YAML key of each field of |t| to its type.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue // not exported
+		}
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// checkKnownFields walks |node| along with |t| and adds a diagnostic
+// to |ds| for every mapping key that does not correspond to any field.
+func (ds *Diagnostics) checkKnownFields(
+	filename string, node *yaml.Node, t reflect.Type,
+) {
+	node = resolve(node)
+	if node == nil {
+		return
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		return // the type knows how to deal with its own keys
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return // the decoder will complain about this
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			fieldType, found := fields[key.Value]
+			if !found {
+				ds.add(filename, key, "unknown key %q", key.Value)
+				continue
+			}
+			ds.checkKnownFields(filename, value, fieldType)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 1; i < len(node.Content); i += 2 {
+			ds.checkKnownFields(filename, node.Content[i], t.Elem())
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, child := range node.Content {
+			ds.checkKnownFields(filename, child, t.Elem())
+		}
+	}
+}
+
+// mappingValue returns the value of |key| in the |node| mapping or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return resolve(node.Content[i+1])
+		}
+	}
+	return nil
+}
+
+// lookup returns the node reached by following |keys| from |node| and
+// whether all keys were found. When a key is missing, it returns the
+// deepest node that we could reach, so that diagnostics still point
+// to a meaningful position inside the file.
+func lookup(node *yaml.Node, keys ...string) (*yaml.Node, bool) {
+	node = resolve(node)
+	for _, key := range keys {
+		next := mappingValue(node, key)
+		if next == nil {
+			return node, false
+		}
+		node = next
+	}
+	return node, true
+}
+
+// item returns the |idx|-th item of the |node| sequence or |node| itself
+// when |node| is not a sequence that long.
+func item(node *yaml.Node, idx int) *yaml.Node {
+	if node != nil && node.Kind == yaml.SequenceNode && idx < len(node.Content) {
+		return node.Content[idx]
+	}
+	return node
+}
+
+// versionRe matches a package version, which CMake wants to have at
+// most four numeric components.
+var versionRe = regexp.MustCompile(`^[0-9]+(\.[0-9]+){0,3}$`)
+
+// validate performs semantic checks on |pkginfo| using |root| to
+// find out the position of problems inside |filename|. The returned
+// diagnostics are not sorted by position.
+func (pkginfo *PkgInfo) validate(filename string, root *yaml.Node) Diagnostics {
+	var ds Diagnostics
+	if pkginfo.Name == "" {
+		node, _ := lookup(root, "name")
+		ds.add(filename, node, "missing or empty key \"name\"")
+	}
+	switch pkginfo.CMakeStyle {
+	case "", "global", "targets":
+	default:
+		node, _ := lookup(root, "cmake_style")
+		ds.add(filename, node, "cmake_style: %q is neither \"global\" nor \"targets\"",
+			pkginfo.CMakeStyle)
+	}
+	for id, dep := range pkginfo.CustomDependencies {
+		if dep == nil {
+			node, _ := lookup(root, "custom_dependencies", id)
+			ds.add(filename, node, "custom dependency %q: empty definition", id)
+		} else if err := dep.Validate(); err != nil {
+			node, _ := lookup(root, "custom_dependencies", id)
+			ds.add(filename, node, "custom dependency %q: %s", id, err.Error())
+		}
+	}
+	resolvable := true
+	for idx, ref := range pkginfo.Dependencies {
+		if _, err := pkginfo.Registry.Resolve(ref); err != nil {
+			node, _ := lookup(root, "dependencies")
+			ds.add(filename, item(node, idx), "%s", err.Error())
+			resolvable = false
+		}
+	}
+	if resolvable {
+		if _, err := pkginfo.Resolve(); err != nil {
+			node, _ := lookup(root, "dependencies")
+			ds.add(filename, node, "%s", err.Error())
+		}
+	}
+	if optional, found := lookup(root, "optional_dependencies"); found {
+		if _, err := pkginfo.ResolveOptional(); err != nil {
+			ds.add(filename, optional, "%s", err.Error())
+		}
+	}
+	checkLink := func(node *yaml.Node, link []string) {
+		for idx, name := range link {
+			if _, found := pkginfo.Targets.Libraries[name]; found {
+				continue
+			}
+			if pkginfo.Registry.Has(name) {
+				// We would pass the ID as is to target_link_libraries
+				ds.add(filename, item(node, idx),
+					"link: %q is a dependency: list it in the target \"dependencies\" instead",
+					name)
+				continue
+			}
+			ds.add(filename, item(node, idx),
+				"link: %q is not a library in targets.libraries", name)
+		}
+	}
+	checkDependencies := func(kind, name string, refs deps.Refs) {
+		if _, err := pkginfo.TargetDependencies(refs); err != nil {
+			node, _ := lookup(root, "targets", kind, name, "dependencies")
+			ds.add(filename, node, "%s %q: %s", kind[:len(kind)-1], name, err.Error())
+		}
+	}
+	if pkginfo.Version != "" && !versionRe.MatchString(pkginfo.Version) {
+		node, _ := lookup(root, "version")
+		ds.add(filename, node, "version: %q is not like \"1.2.3\"", pkginfo.Version)
+	}
+	for name, buildinfo := range pkginfo.Targets.Libraries {
+		compile, found := lookup(root, "targets", "libraries", name, "compile")
+		if found && len(buildinfo.Compile) <= 0 {
+			ds.add(filename, compile, "library %q: empty compile list", name)
+		}
+		kind, _ := lookup(root, "targets", "libraries", name, "type")
+		switch buildinfo.Type {
+		case "", "static", "shared", "object":
+			if buildinfo.Type != "" && !found {
+				ds.add(filename, kind, "library %q: %s library without compile list",
+					name, buildinfo.Type)
+			}
+		case "interface":
+			if found {
+				ds.add(filename, compile, "library %q: interface library with compile list", name)
+			}
+		default:
+			ds.add(filename, kind,
+				"library %q: type %q is not one of static, shared, object, interface",
+				name, buildinfo.Type)
+		}
+		link, _ := lookup(root, "targets", "libraries", name, "link")
+		checkLink(link, buildinfo.Link)
+		checkDependencies("libraries", name, buildinfo.Dependencies)
+	}
+	for name, buildinfo := range pkginfo.Targets.Executables {
+		compile, _ := lookup(root, "targets", "executables", name, "compile")
+		if len(buildinfo.Compile) <= 0 {
+			ds.add(filename, compile, "executable %q: empty compile list", name)
+		}
+		link, _ := lookup(root, "targets", "executables", name, "link")
+		checkLink(link, buildinfo.Link)
+		checkDependencies("executables", name, buildinfo.Dependencies)
+	}
+	for name, testinfo := range pkginfo.Tests {
+		command, _ := lookup(root, "tests", name, "command")
+		argv := strings.Fields(testinfo.Command)
+		if len(argv) <= 0 {
+			ds.add(filename, command, "test %q: empty command", name)
+			continue
+		}
+		_, isExe := pkginfo.Targets.Executables[argv[0]]
+		_, isScript := pkginfo.Targets.Scripts[argv[0]]
+		if !isExe && !isScript {
+			ds.add(filename, command,
+				"test %q: %q is neither in targets.executables nor in targets.scripts",
+				name, argv[0])
+		}
+	}
+	return ds
+}
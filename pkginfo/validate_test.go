@@ -0,0 +1,183 @@
+package pkginfo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/measurement-kit/mkbuild/cmake/deps"
+)
+
+// parseString parses |data| as the MKBuild.yaml of an empty directory,
+// using just the default registry.
+func parseString(t *testing.T, data string) (*PkgInfo, error) {
+	dir, err := ioutil.TempDir("", "mkbuild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if value, found := os.LookupEnv(deps.EnvVar); found {
+		os.Unsetenv(deps.EnvVar)
+		defer os.Setenv(deps.EnvVar, value)
+	}
+	return parse(filepath.Join(dir, "MKBuild.yaml"), []byte(data))
+}
+
+func TestParseValid(t *testing.T) {
+	pkginfo, err := parseString(t, `name: mkcurl
+version: 0.12.0
+cmake_style: targets
+dependencies:
+- github.com/catchorg/catch2
+- github.com/curl/curl: ">=7.58"
+optional_dependencies: [github.com/c-ares/c-ares]
+targets:
+  libraries:
+    mkcurl:
+      type: shared
+      compile: [mkcurl.cpp]
+      dependencies: [github.com/curl/curl]
+    mkcurl-headers:
+      headers: [mkcurl.hpp]
+  executables:
+    tests:
+      compile: [tests.cpp]
+      link: [mkcurl]
+tests:
+  unit_tests:
+    command: tests --verbose
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkginfo.Name != "mkcurl" || len(pkginfo.Dependencies) != 2 {
+		t.Fatalf("unexpected pkginfo: %+v", pkginfo)
+	}
+}
+
+func TestParseDiagnostics(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data string
+		want []string
+	}{{
+		name: "unknown keys",
+		data: "name: x\ntargets:\n  executables:\n    a:\n      comple: [a.cpp]\n      compile: [a.cpp]\nfoo: 1\n",
+		want: []string{
+			"5:7: unknown key \"comple\"",
+			"7:1: unknown key \"foo\"",
+		},
+	}, {
+		name: "missing name",
+		data: "docker: x\n",
+		want: []string{"1:1: missing or empty key \"name\""},
+	}, {
+		name: "empty compile lists",
+		data: "name: x\ntargets:\n  libraries:\n    a:\n      compile: []\n  executables:\n    b:\n      link: [a]\n",
+		want: []string{
+			"5:16: library \"a\": empty compile list",
+			"8:7: executable \"b\": empty compile list",
+		},
+	}, {
+		name: "unknown link",
+		data: "name: x\ntargets:\n  executables:\n    a:\n      compile: [a.cpp]\n      link: [a, nonexistent]\n",
+		want: []string{
+			"6:14: link: \"a\" is not a library in targets.libraries",
+			"6:17: link: \"nonexistent\" is not a library in targets.libraries",
+		},
+	}, {
+		name: "dependency in link",
+		data: "name: x\ndependencies: [github.com/curl/curl]\ntargets:\n  executables:\n    a:\n      compile: [a.cpp]\n      link: [github.com/curl/curl]\n",
+		want: []string{
+			"7:14: link: \"github.com/curl/curl\" is a dependency: list it in the target \"dependencies\" instead",
+		},
+	}, {
+		name: "test commands",
+		data: "name: x\ntests:\n  a:\n    command: missing --flag\n  b:\n    command: \"\"\n",
+		want: []string{
+			"4:14: test \"a\": \"missing\" is neither in targets.executables nor in targets.scripts",
+			"6:14: test \"b\": empty command",
+		},
+	}, {
+		name: "invalid version and cmake_style",
+		data: "name: x\nversion: 1.2.3.4.5\ncmake_style: modern\n",
+		want: []string{
+			"2:10: version: \"1.2.3.4.5\" is not like \"1.2.3\"",
+			"3:14: cmake_style: \"modern\" is neither \"global\" nor \"targets\"",
+		},
+	}, {
+		name: "library types",
+		data: "name: x\ntargets:\n  libraries:\n    a:\n      type: shared\n    b:\n      type: interface\n      compile: [b.cpp]\n    c:\n      type: module\n",
+		want: []string{
+			"5:13: library \"a\": shared library without compile list",
+			"8:16: library \"b\": interface library with compile list",
+			"10:13: library \"c\": type \"module\" is not one of static, shared, object, interface",
+		},
+	}, {
+		name: "unknown dependencies",
+		data: "name: x\ndependencies:\n- github.com/catchorg/catch2\n- example.com/missing\n",
+		want: []string{"4:3: unknown dependency: example.com/missing"},
+	}, {
+		name: "custom dependency without definition",
+		data: "name: x\ndependencies: [example.com/foo]\ncustom_dependencies: {example.com/foo: }\n",
+		want: []string{
+			"2:16: unknown dependency: example.com/foo",
+			"3:40: custom dependency \"example.com/foo\": empty definition",
+		},
+	}, {
+		name: "target dependencies",
+		data: "name: x\ntargets:\n  executables:\n    a:\n      compile: [a.cpp]\n      dependencies: [github.com/curl/curl]\n",
+		want: []string{
+			"6:21: executable \"a\": github.com/curl/curl: neither in dependencies nor in optional_dependencies",
+		},
+	}, {
+		name: "optional dependencies",
+		data: "name: x\ndependencies: [github.com/curl/curl]\noptional_dependencies: [github.com/curl/curl]\n",
+		want: []string{"3:24: github.com/curl/curl: both required and optional"},
+	}, {
+		name: "invalid YAML",
+		data: "name: x\ntargets: [\n",
+		want: []string{"2: did not find expected node content"},
+	}, {
+		name: "type errors",
+		data: "name: [x]\n",
+		want: []string{"1: cannot unmarshal !!seq into string"},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseString(t, tc.data)
+			ds, ok := err.(Diagnostics)
+			if !ok {
+				t.Fatalf("expected Diagnostics, got %v", err)
+			}
+			if len(ds) != len(tc.want) {
+				t.Fatalf("expected %d diagnostics, got:\n%s", len(tc.want), ds.Error())
+			}
+			for idx, d := range ds {
+				if !strings.HasSuffix(d.Filename, "MKBuild.yaml") {
+					t.Errorf("unexpected filename: %s", d.Filename)
+				}
+				got := strings.TrimPrefix(d.String(), d.Filename+":")
+				if !strings.HasPrefix(got, tc.want[idx]) {
+					t.Errorf("expected %q, got %q", tc.want[idx], got)
+				}
+			}
+		})
+	}
+}
+
+func TestDiagnosticString(t *testing.T) {
+	d := Diagnostic{Filename: "MKBuild.yaml", Line: 3, Column: 5, Message: "oops"}
+	if got := d.String(); got != "MKBuild.yaml:3:5: oops" {
+		t.Fatalf("unexpected %q", got)
+	}
+	d.Column = 0
+	if got := d.String(); got != "MKBuild.yaml:3: oops" {
+		t.Fatalf("unexpected %q", got)
+	}
+	ds := Diagnostics{d, d}
+	if got := ds.Error(); got != "MKBuild.yaml:3: oops\nMKBuild.yaml:3: oops" {
+		t.Fatalf("unexpected %q", got)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/measurement-kit/mkbuild/cmake/cmakefile"
+)
+
+// fileSHA256 returns the SHA256 of |filename|.
+func fileSHA256(filename string) (string, error) {
+	filep, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer filep.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, filep); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// fetch downloads |URL| into |filename| using |client| and makes sure
+// that the content has the expected |SHA256|.
+func fetch(client *http.Client, URL, SHA256, filename string) error {
+	resp, err := client.Get(URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("GET %s: %s", URL, resp.Status)
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	filep, err := ioutil.TempFile(filepath.Dir(filename), ".mkbuild")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(filep.Name())
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(filep, hash), resp.Body)
+	if err != nil {
+		filep.Close()
+		return fmt.Errorf("cannot download %s: %s", URL, err.Error())
+	}
+	if err := filep.Close(); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != SHA256 {
+		return fmt.Errorf("SHA256 mismatch for %s: expected %s, found %s",
+			URL, SHA256, actual)
+	}
+	return os.Rename(filep.Name(), filename)
+}
+
+// runVendor implements `mkbuild vendor`.
+func runVendor(ctx *context, args []string) error {
+	flags := flag.NewFlagSet("vendor", flag.ExitOnError)
+	dir := flags.String("dir", "third_party", "Write dependencies into `dir`")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		return fmt.Errorf("vendor: unexpected arguments: %v", flags.Args())
+	}
+	if !filepath.IsAbs(*dir) {
+		*dir = ctx.outputFilename(*dir)
+	}
+	pkginfo, err := ctx.loadPkgInfo()
+	if err != nil {
+		return err
+	}
+	resolved, err := pkginfo.Resolve()
+	if err != nil {
+		return err
+	}
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	transport.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	client := &http.Client{Timeout: 300 * time.Second, Transport: transport}
+	var mirrors []string
+	if env := os.Getenv("MKBUILD_MIRROR"); env != "" {
+		mirrors = strings.Split(env, ";")
+	}
+	mirrors = append(mirrors, pkginfo.Mirrors...)
+	for _, dep := range resolved {
+		if dep.URL == "" {
+			continue // nothing to download
+		}
+		vendored := cmakefile.VendoredPath(dep.URL)
+		filename := filepath.Join(*dir, filepath.FromSlash(vendored))
+		if actual, err := fileSHA256(filename); err == nil && actual == dep.SHA256 {
+			log.Debugf("%s: up to date", filename)
+			continue
+		} else if err == nil {
+			log.Warnf("%s: SHA256 mismatch; downloading it again", filename)
+		}
+		var sources []string
+		for _, mirror := range mirrors {
+			sources = append(sources, strings.TrimRight(mirror, "/")+"/"+vendored)
+		}
+		sources = append(sources, dep.URLs()...)
+		var failures []string
+		for _, source := range sources {
+			log.Infof("Fetching %s", source)
+			err := fetch(client, source, dep.SHA256, filename)
+			if err == nil {
+				break
+			}
+			log.WithError(err).Warnf("cannot fetch %s", source)
+			failures = append(failures, err.Error())
+		}
+		if len(failures) >= len(sources) {
+			return fmt.Errorf("%s: all sources failed:\n  %s", dep.ID,
+				strings.Join(failures, "\n  "))
+		}
+		log.Infof("Written %s", filename)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"fmt"
+)
+
+// runVersion implements `mkbuild version`.
+func runVersion(ctx *context, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("version: unexpected arguments: %v", args)
+	}
+	fmt.Println(version)
+	return nil
+}